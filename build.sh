@@ -51,7 +51,8 @@ build() {
     mkdir -p build
     
     # Build using the cmd/git-multi-push directory
-    GOOS=$target_os GOARCH=$target_arch go build -o "build/${output_name}" ./cmd/git-multi-push
+    # Optional features are picked with GO_TAGS, e.g. GO_TAGS=dashboard
+    GOOS=$target_os GOARCH=$target_arch go build -tags "${GO_TAGS}" -o "build/${output_name}" ./cmd/git-multi-push
     
     if [ $? -eq 0 ]; then
         echo_success "Built for ${target_os}/${target_arch}"
@@ -0,0 +1,56 @@
+﻿package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+)
+
+var colorEnabled bool
+
+// CI runners often look like a terminal but their log viewers show the raw
+// escape codes
+var ciEnvVars = []string{"CI", "GITHUB_ACTIONS", "GITLAB_CI", "BUILDKITE", "CIRCLECI", "JENKINS_URL", "TF_BUILD"}
+
+func setupColor(mode string) error {
+	switch mode {
+	case "always":
+		colorEnabled = true
+	case "never":
+		colorEnabled = false
+	case "auto":
+		colorEnabled = stdoutIsTerminal() && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && !runningInCI()
+	default:
+		return fmt.Errorf("unknown --color '%s', expected auto, always or never", mode)
+	}
+	return nil
+}
+
+func runningInCI() bool {
+	for _, name := range ciEnvVars {
+		if value := os.Getenv(name); value != "" && value != "false" && value != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func colorize(color, text string) string {
+	if !colorEnabled {
+		return text
+	}
+	return "\033[" + color + "m" + text + "\033[0m"
+}
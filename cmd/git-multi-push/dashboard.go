@@ -0,0 +1,86 @@
+﻿//go:build dashboard
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"git-multi-push/pkg/git"
+)
+
+func runDashboard(gitOp *git.GitOperation, interval time.Duration) int {
+	// Without a terminal there is nothing to refresh, print the table once
+	if !stdoutIsTerminal() {
+		return renderDashboard(gitOp, false)
+	}
+
+	keys := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			keys <- strings.TrimSpace(scanner.Text())
+		}
+		close(keys)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		renderDashboard(gitOp, true)
+		fmt.Printf("\nRefreshing every %s. Press Enter to refresh now, q and Enter to quit.\n", interval)
+
+		select {
+		case key, ok := <-keys:
+			if !ok || key == "q" {
+				return 0
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+func renderDashboard(gitOp *git.GitOperation, clear bool) int {
+	statuses, err := gitOp.MirrorStatus()
+	if clear {
+		fmt.Print("\033[H\033[2J")
+	}
+	if err != nil {
+		fmt.Println(err)
+		return exitFailure
+	}
+
+	code := 0
+	fmt.Printf("Mirror status at %s\n\n", time.Now().Format("15:04:05"))
+	fmt.Printf("%-12s %-20s %-16s %s\n", "REMOTE", "BRANCH", "SYNC", "LAST PUSH")
+	for _, status := range statuses {
+		// Pad before coloring, escape codes would throw off the widths
+		sync, color := "in sync", colorGreen
+		switch {
+		case status.Err != nil:
+			sync, color = "error", colorRed
+			code = exitFailure
+		case status.Missing:
+			sync, color = "not pushed", colorYellow
+		case status.Ahead > 0 || status.Behind > 0:
+			sync, color = fmt.Sprintf("+%d -%d", status.Ahead, status.Behind), colorYellow
+		}
+
+		lastPush := "-"
+		switch status.LastPush {
+		case "ok":
+			lastPush = colorize(colorGreen, "ok") + " " + status.LastPushAt.Format("2006-01-02 15:04")
+		case "failed":
+			lastPush = colorize(colorRed, "failed") + " " + status.LastPushAt.Format("2006-01-02 15:04")
+		}
+
+		fmt.Printf("%-12s %-20s %s %s\n", status.RemoteName, status.Branch, colorize(color, fmt.Sprintf("%-16s", sync)), lastPush)
+		if status.Err != nil {
+			fmt.Printf("  %v\n", status.Err)
+		}
+	}
+	return code
+}
@@ -0,0 +1,15 @@
+﻿//go:build !dashboard
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"git-multi-push/pkg/git"
+)
+
+func runDashboard(gitOp *git.GitOperation, interval time.Duration) int {
+	fmt.Println("This binary was built without the dashboard, rebuild it with: go build -tags dashboard ./cmd/git-multi-push")
+	return exitFailure
+}
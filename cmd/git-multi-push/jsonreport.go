@@ -0,0 +1,55 @@
+﻿package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"git-multi-push/pkg/git"
+)
+
+type jsonRemote struct {
+	Name     string  `json:"name"`
+	Branch   string  `json:"branch,omitempty"`
+	Status   string  `json:"status"`
+	Failure  string  `json:"failure,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+type jsonReport struct {
+	Branch  string       `json:"branch"`
+	Success bool         `json:"success"`
+	Remotes []jsonRemote `json:"remotes"`
+	Errors  []string     `json:"errors,omitempty"`
+}
+
+func newJSONReport(branch string, results []git.MirrorResult, errs []string) jsonReport {
+	report := jsonReport{Branch: branch, Success: len(errs) == 0, Remotes: []jsonRemote{}, Errors: errs}
+	for _, result := range results {
+		remote := jsonRemote{
+			Name:     result.RemoteName,
+			Branch:   result.Branch,
+			Status:   "ok",
+			Duration: result.Duration.Seconds(),
+		}
+		switch {
+		case result.Skipped:
+			remote.Status = "skipped"
+		case !result.Success:
+			remote.Status = "failed"
+			remote.Failure = result.Failure
+			report.Success = false
+		}
+		if result.Err != nil {
+			remote.Error = result.Err.Error()
+		}
+		report.Remotes = append(report.Remotes, remote)
+	}
+	return report
+}
+
+func writeJSONReport(w io.Writer, report jsonReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,96 @@
+﻿package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevels = map[string]int{"debug": levelDebug, "info": levelInfo, "warn": levelWarn, "error": levelError}
+
+func parseLogLevel(name string) (int, error) {
+	level, ok := logLevels[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown --log-level '%s', expected debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// A log.Logger whose errors always show and whose Fatal calls get a chance
+// to report the error before the process exits, --json uses that to still
+// print its object. Print and Infof log at the info level, Warnf at the
+// warn level
+type cliLogger struct {
+	*log.Logger
+	warnings   *log.Logger
+	errors     *log.Logger
+	beforeExit func(message string)
+	// Run on every exit through Exit or Fatal, e.g. to release the lock
+	cleanups []func()
+}
+
+func newCLILogger(out io.Writer, level int) *cliLogger {
+	return &cliLogger{
+		Logger:   log.New(writerAt(out, levelInfo, level), "", log.LstdFlags),
+		warnings: log.New(writerAt(out, levelWarn, level), "", log.LstdFlags),
+		errors:   log.New(out, "", log.LstdFlags),
+	}
+}
+
+// out if lines at this level show at the chosen one, io.Discard otherwise
+func writerAt(out io.Writer, lineLevel, level int) io.Writer {
+	if lineLevel < level {
+		return io.Discard
+	}
+	return out
+}
+
+func (l *cliLogger) Infof(format string, v ...interface{}) {
+	l.Logger.Output(2, fmt.Sprintf(format, v...))
+}
+
+func (l *cliLogger) Warnf(format string, v ...interface{}) {
+	l.warnings.Output(2, "Warning: "+fmt.Sprintf(format, v...))
+}
+
+func (l *cliLogger) Error(v ...interface{}) {
+	l.errors.Output(2, fmt.Sprint(v...))
+}
+
+func (l *cliLogger) Fatal(v ...interface{}) {
+	l.exit(fmt.Sprint(v...))
+}
+
+func (l *cliLogger) Fatalf(format string, v ...interface{}) {
+	l.exit(fmt.Sprintf(format, v...))
+}
+
+func (l *cliLogger) exit(message string) {
+	l.errors.Output(3, message)
+	if l.beforeExit != nil {
+		l.beforeExit(message)
+	}
+	l.Exit(exitFailure)
+}
+
+func (l *cliLogger) atExit(cleanup func()) {
+	l.cleanups = append(l.cleanups, cleanup)
+}
+
+// Like os.Exit, after running the cleanups, which deferred calls don't get
+// to do
+func (l *cliLogger) Exit(code int) {
+	for i := len(l.cleanups) - 1; i >= 0; i-- {
+		l.cleanups[i]()
+	}
+	os.Exit(code)
+}
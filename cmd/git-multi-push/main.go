@@ -2,174 +2,1620 @@
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"git-multi-push/pkg/git"
 )
 
+// Exit codes used by --health-exit-code
+const (
+	exitFailure     = 1
+	exitUnreachable = 3
+	exitAuthFailed  = 4
+	exitRejected    = 5
+	exitDrift       = 6
+)
+
+func healthExitCode(results []git.MirrorResult) int {
+	code := exitFailure
+	for _, result := range results {
+		switch result.Failure {
+		case git.FailureAuth:
+			return exitAuthFailed
+		case git.FailureUnreachable:
+			code = exitUnreachable
+		case git.FailureRejected, git.FailureProtected:
+			if code != exitUnreachable {
+				code = exitRejected
+			}
+		}
+	}
+	return code
+}
+
+func printPushSummary(results []git.MirrorResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Println("\nPush summary:")
+	for _, result := range results {
+		status := colorize(colorGreen, "OK")
+		switch {
+		case result.Skipped:
+			status = "skipped (already up to date)"
+		case !result.Success:
+			status = colorize(colorRed, fmt.Sprintf("FAILED (%s)", result.Failure))
+		}
+		fmt.Printf("  %s: %s\n", result.Label(), status)
+	}
+}
+
+// Prints the pushed commit with a link to it on every remote that has a web
+// interface, to click through and check the push landed
+func printCommitLinks(gitOp *git.GitOperation, results []git.MirrorResult) error {
+	commit, err := gitOp.GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	remotes, err := gitOp.Remotes()
+	if err != nil {
+		return err
+	}
+	pushed := map[string]bool{}
+	for _, result := range results {
+		pushed[result.RemoteName] = result.Success
+	}
+
+	fmt.Printf("\nPushed commit %s\n", commit)
+	for _, remote := range remotes {
+		if !pushed[remote.Name] {
+			continue
+		}
+		if link := git.CommitWebURL(remote, commit); link != "" {
+			fmt.Printf("  %s: %s\n", remote.Name, link)
+		}
+	}
+	return nil
+}
+
+// Prints how far each remote's copy of the branch is ahead or behind and
+// reports whether any of them has commits the local branch doesn't. Only
+// the named remotes are looked at, unless there are none
+func printDivergence(gitOp *git.GitOperation, only []string) (bool, error) {
+	statuses, err := gitOp.MirrorStatus(only...)
+	if err != nil {
+		return false, err
+	}
+
+	remoteAhead := false
+	fmt.Println("Divergence from remotes:")
+	for _, status := range statuses {
+		switch {
+		case status.Err != nil:
+			fmt.Printf("  %s: unknown (%v)\n", status.RemoteName, status.Err)
+		case status.Missing:
+			fmt.Printf("  %s: %s not pushed yet\n", status.RemoteName, status.Branch)
+		case status.Ahead == 0 && status.Behind == 0:
+			fmt.Printf("  %s: in sync\n", status.RemoteName)
+		default:
+			fmt.Printf("  %s: %d to push, %d to pull\n", status.RemoteName, status.Ahead, status.Behind)
+		}
+		remoteAhead = remoteAhead || status.Behind > 0
+	}
+	return remoteAhead, nil
+}
+
+// Catches a misspelled --remote before anything is fetched
+func checkRemoteNames(gitOp *git.GitOperation, names []string) error {
+	remotes, err := gitOp.Remotes()
+	if err != nil {
+		return err
+	}
+	configured := map[string]bool{}
+	known := []string{}
+	for _, remote := range remotes {
+		configured[remote.Name] = true
+		known = append(known, remote.Name)
+	}
+	for _, name := range names {
+		if !configured[name] {
+			return fmt.Errorf("remote '%s' is not configured, expected one of %s", name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+func confirmForcePush(gitOp *git.GitOperation, opts git.PushOptions) error {
+	targets, branch, err := gitOp.PushTargets(opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(promptOut, "\nForce pushing overwrites whatever is there on:")
+	for _, target := range targets {
+		fmt.Fprintf(promptOut, "  %s: %s\n", target.RemoteName, target.Refs)
+	}
+	if readUserInput(fmt.Sprintf("Type the branch name (%s) to force push: ", branch)) != branch {
+		return fmt.Errorf("force push cancelled, nothing was pushed")
+	}
+	return nil
+}
+
+// Mirroring deletes whatever the remotes have that this repository doesn't,
+// so the answer has to be typed out
+func confirmMirrorPush(gitOp *git.GitOperation, opts git.PushOptions) error {
+	targets, _, err := gitOp.PushTargets(opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(promptOut, "\nWARNING: --mirror makes these remotes exact copies of this repository.")
+	fmt.Fprintln(promptOut, "Branches and tags that don't exist locally are DELETED from them:")
+	for _, target := range targets {
+		fmt.Fprintf(promptOut, "  %s: %s\n", target.RemoteName, target.Refs)
+	}
+	if readUserInput("Type 'mirror' to push: ") != "mirror" {
+		return fmt.Errorf("mirror push cancelled, nothing was pushed")
+	}
+	return nil
+}
+
+// One answer covers every repository, typed out like the single-repository
+// confirmations
+func confirmRecursiveForce(root string, repos []string, opts git.PushOptions) error {
+	word := "force"
+	if opts.Mirror {
+		word = "mirror"
+		fmt.Fprintln(promptOut, "\nWARNING: --mirror deletes the branches and tags that don't exist locally from the remotes of every one of these repositories:")
+	} else {
+		fmt.Fprintln(promptOut, "\nForce pushing overwrites whatever the remotes have for every one of these repositories:")
+	}
+	for _, repo := range repos {
+		name, err := filepath.Rel(root, repo)
+		if err != nil || name == "." {
+			name = filepath.Base(repo)
+		}
+		fmt.Fprintf(promptOut, "  %s\n", name)
+	}
+	if readUserInput(fmt.Sprintf("Type '%s' to push all %d repositories: ", word, len(repos))) != word {
+		return fmt.Errorf("%s push cancelled, nothing was pushed", word)
+	}
+	return nil
+}
+
+// Where questions are asked, --quiet silences stdout but not them
+var promptOut io.Writer = os.Stdout
+
 func readUserInput(prompt string) string {
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Print(prompt)
+	fmt.Fprint(promptOut, prompt)
 	input, _ := reader.ReadString('\n')
 	return strings.TrimSpace(input)
 }
 
-func handleCommit(gitOp *git.GitOperation) error {
-	hasChanges, err := gitOp.HasUncommittedChanges()
+type confirmation struct {
+	words      []string
+	defaultYes bool
+}
+
+func (c confirmation) ask(question string) bool {
+	hint := "[y/N]"
+	if c.defaultYes {
+		hint = "[Y/n]"
+	}
+
+	answer := strings.ToLower(readUserInput(fmt.Sprintf("%s %s: ", question, hint)))
+	if answer == "" {
+		return c.defaultYes
+	}
+	for _, word := range c.words {
+		if answer == strings.ToLower(word) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSelection(input string, max int) ([]int, error) {
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("nothing selected")
+	}
+
+	seen := map[int]bool{}
+	indices := []int{}
+	for _, field := range fields {
+		start, end := field, field
+		if parts := strings.SplitN(field, "-", 2); len(parts) == 2 {
+			start, end = parts[0], parts[1]
+		}
+
+		first, err := strconv.Atoi(start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection '%s'", field)
+		}
+		last, err := strconv.Atoi(end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection '%s'", field)
+		}
+		if first < 1 || last > max || first > last {
+			return nil, fmt.Errorf("selection '%s' is out of range (1-%d)", field, max)
+		}
+
+		for i := first; i <= last; i++ {
+			if !seen[i] {
+				seen[i] = true
+				indices = append(indices, i-1)
+			}
+		}
+	}
+	return indices, nil
+}
+
+func selectFiles(gitOp *git.GitOperation) ([]string, error) {
+	files, err := gitOp.ChangedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("\nChanged files:")
+	for i, file := range files {
+		fmt.Printf("%d: %s\n", i+1, file)
+	}
+
+	input := readUserInput("\nEnter the numbers of the files to include (e.g. 1,3-5): ")
+	indices, err := parseSelection(input, len(files))
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []string{}
+	for _, i := range indices {
+		selected = append(selected, files[i])
+	}
+	return selected, nil
+}
+
+func askHostedRemote(name, label, host, detectedRepo string) (*git.Remote, error) {
+	username := readUserInput(label + " username: ")
+	if username == "" {
+		return nil, nil
+	}
+
+	// Enterprise and self-hosted instances can't be told apart by their
+	// host name, so the provider is kept along with the host
+	provider := ""
+	if custom := readUserInput(fmt.Sprintf("%s host [%s]: ", label, host)); custom != "" && custom != host {
+		host, provider = strings.ToLower(custom), name
+	}
+
+	var repo string
+	if detectedRepo != "" {
+		repo = readUserInput(fmt.Sprintf("%s repository name (Enter for '%s' from the existing remote): ", label, detectedRepo))
+		if repo == "" {
+			repo = detectedRepo
+		}
+	} else {
+		repo = readUserInput(label + " repository name (e.g., 'repository-name', Enter to use the directory name): ")
+		if repo == "" {
+			repo = "{dirname}"
+		}
+	}
+
+	// Empty means ssh, which is left out of the config
+	protocol := readUserInput(label + " protocol (ssh/https) [ssh]: ")
+	if protocol == "ssh" {
+		protocol = ""
+	}
+	if err := git.ValidateProtocol(protocol); err != nil {
+		return nil, err
+	}
+	return &git.Remote{Name: name, Host: host, Username: username, Repo: repo, Protocol: protocol, Provider: provider}, nil
+}
+
+// The repository name the existing remotes use, preferring origin. Empty
+// when it matches the directory name, {dirname} covers that already
+func detectRepoName(gitOp *git.GitOperation) string {
+	isRepo, rootDir := gitOp.IsGitRepo()
+	if !isRepo {
+		return ""
+	}
+	remotes, err := gitOp.GitRemotes()
+	if err != nil || len(remotes) == 0 {
+		return ""
+	}
+
+	url := remotes[0].URL
+	for _, remote := range remotes {
+		if remote.Name == "origin" {
+			url = remote.URL
+		}
+	}
+	name, err := git.ExtractRepoName(url)
+	if err != nil || name == filepath.Base(rootDir) {
+		return ""
+	}
+	return name
+}
+
+func selectGitRemotes(gitOp *git.GitOperation) ([]git.Remote, error) {
+	if isRepo, _ := gitOp.IsGitRepo(); !isRepo {
+		return nil, nil
+	}
+	existing, err := gitOp.GitRemotes()
+	if err != nil || len(existing) == 0 {
+		return nil, err
+	}
+
+	fmt.Println("\nExisting git remotes:")
+	for i, remote := range existing {
+		fmt.Printf("%d: %s %s\n", i+1, remote.Name, remote.URL)
+	}
+
+	input := readUserInput("\nEnter the numbers of the remotes to manage (e.g. 1,3-5, press Enter to skip): ")
+	if input == "" {
+		return nil, nil
+	}
+	indices, err := parseSelection(input, len(existing))
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []git.Remote{}
+	for _, i := range indices {
+		remote := existing[i]
+		parsed, err := git.ParseRemoteURL(remote.URL)
+		if err != nil {
+			return nil, fmt.Errorf("remote %s: %v", remote.Name, err)
+		}
+
+		provider := readUserInput(fmt.Sprintf("Provider for %s (github/gitlab/bitbucket/local/generic) [%s]: ", remote.Name, parsed.Provider()))
+		switch provider {
+		case "":
+			provider = parsed.Provider()
+		case git.ProviderGithub, git.ProviderGitlab, git.ProviderBitbucket, git.ProviderLocal, git.ProviderGeneric:
+		default:
+			return nil, fmt.Errorf("unknown provider '%s' for remote %s", provider, remote.Name)
+		}
+
+		selected = append(selected, git.Remote{Name: remote.Name, URL: parsed.String(), Provider: provider})
+	}
+	return selected, nil
+}
+
+func mergePaths(paths, extra []string) []string {
+	seen := map[string]bool{}
+	for _, path := range paths {
+		seen[path] = true
+	}
+	for _, path := range extra {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func readCommitMessage(gitOp *git.GitOperation, opts commitOptions) (string, error) {
+	if opts.message != "" {
+		if problems := messageProblems(gitOp, opts.message, opts.lint); len(problems) > 0 {
+			printLintProblems(problems)
+			return "", fmt.Errorf("the given commit message breaks the commit message rules")
+		}
+		return opts.message, nil
+	}
+
+	preset := opts.preset
+	defaultMessage := ""
+	if opts.messageFromBranch && preset == "" {
+		message, err := gitOp.MessageFromBranch()
+		if err != nil {
+			return "", err
+		}
+		defaultMessage = message
+	}
+
+	message, err := chooseCommitMessage(gitOp, preset, defaultMessage)
+	for err == nil {
+		problems := messageProblems(gitOp, message, opts.lint)
+		if len(problems) == 0 {
+			break
+		}
+		printLintProblems(problems)
+		if preset != "" {
+			return "", fmt.Errorf("message preset '%s' breaks the commit message rules", preset)
+		}
+
+		message = readUserInput("Enter commit message: ")
+		if message == "" {
+			return "", fmt.Errorf("commit message cannot be empty")
+		}
+	}
+	return message, err
+}
+
+// The lint rules only count when linting, commit_message_pattern always does
+func messageProblems(gitOp *git.GitOperation, message string, lint bool) []string {
+	problems := []string{}
+	if lint {
+		problems = gitOp.LintMessage(message)
+	}
+	if err := gitOp.ValidateMessage(message); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+func printLintProblems(problems []string) {
+	fmt.Println("\nCommit message problems:")
+	for _, problem := range problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+}
+
+func chooseCommitMessage(gitOp *git.GitOperation, preset, defaultMessage string) (string, error) {
+	if preset != "" {
+		return gitOp.PresetMessage(preset)
+	}
+
+	presets := gitOp.MessagePresets()
+	if len(presets) > 0 {
+		names := git.PresetNames(presets)
+		fmt.Println("\nMessage presets:")
+		for i, name := range names {
+			fmt.Printf("%d: %s (%s)\n", i+1, name, presets[name])
+		}
+
+		choice := readUserInput("Choose a preset (press Enter to type a message): ")
+		if choice != "" {
+			n, err := strconv.Atoi(choice)
+			if err != nil || n < 1 || n > len(names) {
+				return "", fmt.Errorf("invalid preset choice '%s'", choice)
+			}
+			return gitOp.PresetMessage(names[n-1])
+		}
+	}
+
+	if defaultMessage != "" {
+		message := readUserInput(fmt.Sprintf("Enter commit message [%s]: ", defaultMessage))
+		if message == "" {
+			return defaultMessage, nil
+		}
+		return message, nil
+	}
+
+	message := readUserInput("Enter commit message: ")
+	if message == "" {
+		return "", fmt.Errorf("commit message cannot be empty")
+	}
+	return message, nil
+}
+
+type commitOptions struct {
+	selectFiles bool
+	// Committed instead of everything when set
+	files   []string
+	edit    bool
+	verbose bool
+	preset  string
+	// Given with --message or --message-file, used without asking
+	message string
+	lint    bool
+	// Offer a message derived from the branch name as the default
+	messageFromBranch bool
+	// Fold the changes into the last commit instead of making a new one
+	amend   bool
+	confirm confirmation
+	// Commit without asking first (--yes)
+	assumeYes bool
+}
+
+func handleCommit(gitOp *git.GitOperation, opts commitOptions) error {
+	autoStaged, err := gitOp.AutoStage()
+	if err != nil {
+		return err
+	}
+	if len(autoStaged) > 0 {
+		fmt.Println("\nAuto-staged generated files:")
+		for _, file := range autoStaged {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+
+	if opts.amend {
+		return handleAmend(gitOp, opts, autoStaged)
+	}
+
+	hasChanges, err := gitOp.HasUncommittedChanges()
+	if err != nil {
+		return err
+	}
+
+	if !hasChanges {
+		fmt.Println("No changes to commit")
+		return nil
+	}
+
+	fmt.Println("\nCurrent git status:")
+	if err := gitOp.ShowStatus(); err != nil {
+		return err
+	}
+
+	if !opts.assumeYes && !opts.confirm.ask("\nWould you like to commit these changes?") {
+		return fmt.Errorf("changes must be committed before pushing. Operation cancelled")
+	}
+
+	var paths []string
+	if opts.selectFiles {
+		if paths, err = selectFiles(gitOp); err != nil {
+			return err
+		}
+	} else if len(opts.files) > 0 {
+		paths = opts.files
+	}
+	if len(paths) > 0 {
+		// Auto-staged files go into the commit whatever was selected
+		paths = mergePaths(paths, autoStaged)
+	}
+
+	if opts.edit {
+		// The given message, a preset or the branch message becomes the
+		// starting text in the editor
+		message := opts.message
+		switch {
+		case message != "":
+		case opts.preset != "":
+			if message, err = gitOp.PresetMessage(opts.preset); err != nil {
+				return err
+			}
+		case opts.messageFromBranch:
+			if message, err = gitOp.MessageFromBranch(); err != nil {
+				return err
+			}
+		}
+		if err := gitOp.CommitWithEditor(paths, message, opts.verbose); err != nil {
+			return err
+		}
+		fmt.Println("Changes committed successfully")
+
+		// The editor can't be re-opened mid-commit, so only point out problems
+		if committed, err := gitOp.LastCommitMessage(); err == nil {
+			if problems := messageProblems(gitOp, committed, opts.lint); len(problems) > 0 {
+				printLintProblems(problems)
+				fmt.Println("Use 'git commit --amend' to fix the message before the next push")
+			}
+		}
+		return nil
+	}
+
+	message, err := readCommitMessage(gitOp, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(paths) > 0 {
+		err = gitOp.CommitFiles(message, paths)
+	} else {
+		err = gitOp.Commit(message)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Changes committed successfully")
+	return nil
+}
+
+func handleAmend(gitOp *git.GitOperation, opts commitOptions, autoStaged []string) error {
+	last, err := gitOp.LastCommitMessage()
+	if err != nil {
+		return err
+	}
+	subject, _, _ := strings.Cut(strings.TrimSpace(last), "\n")
+	fmt.Printf("\nLast commit: %s\n", subject)
+
+	pushed, err := gitOp.HeadIsPushed()
+	if err != nil {
+		return err
+	}
+	if pushed {
+		fmt.Println("Warning: this commit has already been pushed. Amending it rewrites history,")
+		fmt.Println("the remotes will only take the new commit with --force-with-lease or --force")
+	}
+
+	if !opts.assumeYes && !opts.confirm.ask("Would you like to amend it?") {
+		return fmt.Errorf("amend cancelled, nothing was changed")
+	}
+
+	// Nothing to stage is fine, the message alone can be changed
+	var paths []string
+	if opts.selectFiles {
+		if paths, err = selectFiles(gitOp); err != nil {
+			return err
+		}
+	} else if len(opts.files) > 0 {
+		paths = opts.files
+	}
+	if len(paths) > 0 {
+		paths = mergePaths(paths, autoStaged)
+	}
+
+	message := opts.message
+	switch {
+	case message != "":
+	case opts.preset != "":
+		if message, err = gitOp.PresetMessage(opts.preset); err != nil {
+			return err
+		}
+	default:
+		message = readUserInput("Enter a new commit message (press Enter to keep the current one): ")
+	}
+
+	if err := gitOp.AmendCommit(message, paths); err != nil {
+		return err
+	}
+	fmt.Println("Last commit amended successfully")
+	return nil
+}
+
+// Returned when a chunk was committed but pushing it failed
+var errChunkPush = errors.New("push failed")
+
+func handleChunkedCommit(gitOp *git.GitOperation, chunkSize int, opts commitOptions, push func() ([]git.MirrorResult, error)) error {
+	files, err := gitOp.StagedFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Println("No staged files to commit")
+		return nil
+	}
+
+	chunks := (len(files) + chunkSize - 1) / chunkSize
+	fmt.Printf("\n%d staged file(s) will be committed and pushed in %d chunk(s) of at most %d\n", len(files), chunks, chunkSize)
+
+	message, err := readCommitMessage(gitOp, opts)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < chunks; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(files) {
+			end = len(files)
+		}
+		chunk := files[i*chunkSize : end]
+
+		chunkMessage := message
+		if chunks > 1 {
+			chunkMessage = fmt.Sprintf("%s (part %d/%d)", message, i+1, chunks)
+		}
+		if err := gitOp.CommitFiles(chunkMessage, chunk); err != nil {
+			return fmt.Errorf("chunk %d/%d: %v\nThe remaining files are still staged; run again to continue", i+1, chunks, err)
+		}
+
+		if _, err := push(); err != nil {
+			return fmt.Errorf("chunk %d/%d: committed, but the %w\nThe remaining %d file(s) are still staged; fix the remotes and run again to continue", i+1, chunks, errChunkPush, len(files)-end)
+		}
+		fmt.Printf("Chunk %d/%d: committed and pushed %d file(s)\n", i+1, chunks, len(chunk))
+	}
+	return nil
+}
+
+// Parses "github=main,gitlab=develop" into the branch to push to on each remote
+func parseRemoteBranches(input string) (map[string]string, error) {
+	branches := map[string]string{}
+	for _, pair := range strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		remote, branch, ok := strings.Cut(pair, "=")
+		if !ok || remote == "" || branch == "" {
+			return nil, fmt.Errorf("invalid remote branch '%s', expected remote=branch", pair)
+		}
+		branches[remote] = branch
+	}
+	return branches, nil
+}
+
+// Maps the answer to the branch list back to a branch. A branch named like
+// a number wins over the number
+func pickBranch(choice string, branches []string) (string, error) {
+	for _, branch := range branches {
+		if branch == choice {
+			return branch, nil
+		}
+	}
+	n, err := strconv.Atoi(choice)
+	if err != nil {
+		return "", fmt.Errorf("branch '%s' not found", choice)
+	}
+	if n < 1 || n > len(branches) {
+		return "", fmt.Errorf("branch number %d is out of range (1-%d)", n, len(branches))
+	}
+	return branches[n-1], nil
+}
+
+func handleMerge(gitOp *git.GitOperation, confirm confirmation) (map[string]string, error) {
+	// Get list of branches first
+	branches, err := gitOp.ListBranches()
+	if err != nil {
+		return nil, err
+	}
+
+	// On a detached HEAD the commit itself is merged
+	currentBranch, detached, err := gitOp.CurrentRef()
+	if err != nil {
+		return nil, err
+	}
+	currentName := currentBranch
+	if detached {
+		currentName = fmt.Sprintf("(detached at %s)", currentBranch[:7])
+	}
+
+	// Filter out current branch from available branches
+	availableBranches := []string{}
+	for _, branch := range branches {
+		if branch != currentBranch {
+			availableBranches = append(availableBranches, branch)
+		}
+	}
+
+	// If no other branches available, skip merge prompt
+	if len(availableBranches) == 0 {
+		fmt.Println("\nNo other branches available for merging.")
+		return nil, nil
+	}
+
+	// Ask if user wants to merge
+	fmt.Printf("\nCurrent branch: %s\n", currentName)
+	if !confirm.ask("Would you like to merge your changes?") {
+		return nil, nil
+	}
+
+	// Show available branches
+	fmt.Println("\nAvailable branches:")
+	for i, branch := range availableBranches {
+		fmt.Printf("%d: %s\n", i+1, branch)
+	}
+
+	// Get target branch
+	targetBranch, err := pickBranch(readUserInput("\nEnter the number or name of the branch to merge into: "), availableBranches)
+	if err != nil {
+		return nil, err
+	}
+
+	// The merged branch can land under another name on some remotes,
+	// e.g. main on GitHub but develop on GitLab
+	input := readUserInput(fmt.Sprintf("Branch on each remote (e.g. gitlab=develop, press Enter to push to '%s' everywhere): ", targetBranch))
+	remoteBranches, err := parseRemoteBranches(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get commit message
+	message := readUserInput("Enter merge commit message: ")
+	if message == "" {
+		message = fmt.Sprintf("Merge branch '%s' into %s", currentName, targetBranch)
+		if detached {
+			message = fmt.Sprintf("Merge commit '%s' into %s", currentBranch, targetBranch)
+		}
+	}
+
+	// Perform merge
+	if err := gitOp.MergeBranch(currentBranch, targetBranch, message); err != nil {
+		if !errors.Is(err, git.ErrMergeConflicts) {
+			return nil, err
+		}
+		fmt.Printf("\n%v\n", err)
+
+		// Aborting is the safe answer, so it's the one Enter gives
+		abortConfirm := confirmation{words: confirm.words, defaultYes: true}
+		if !abortConfirm.ask("Abort the merge? (No leaves it for you to resolve)") {
+			return nil, fmt.Errorf("resolve the conflicts and run git-multi-push --continue, or run it with --abort to undo the merge")
+		}
+		if err := gitOp.AbortMerge(); err != nil {
+			return nil, err
+		}
+		if err := gitOp.RestoreRef(currentBranch, detached); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("merge aborted due to conflicts, back on %s and nothing was pushed", currentName)
+	}
+
+	fmt.Printf("Successfully merged '%s' into '%s'\n", currentName, targetBranch)
+	remotes := make([]string, 0, len(remoteBranches))
+	for remote := range remoteBranches {
+		remotes = append(remotes, remote)
+	}
+	sort.Strings(remotes)
+	for _, remote := range remotes {
+		fmt.Printf("'%s' will be pushed to '%s' on %s\n", targetBranch, remoteBranches[remote], remote)
+	}
+	return remoteBranches, nil
+}
+
+func parseReconcileArgs(args []string) (string, string, error) {
+	from, to := "", ""
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		switch {
+		case ok && key == "from":
+			from = value
+		case ok && key == "to":
+			to = value
+		default:
+			return "", "", fmt.Errorf("unexpected argument '%s', expected from=<remote> to=<remote>", arg)
+		}
+	}
+	if from == "" || to == "" {
+		return "", "", fmt.Errorf("usage: --reconcile from=<remote> to=<remote>")
+	}
+	return from, to, nil
+}
+
+func handleReconcile(gitOp *git.GitOperation, from, to string, confirm confirmation) error {
+	fmt.Printf("Comparing %s with %s...\n", to, from)
+	plan, err := gitOp.PlanReconcile(from, to)
+	if err != nil {
+		return err
+	}
+
+	if len(plan.Missing) == 0 && len(plan.Diverged) == 0 {
+		fmt.Printf("%s is already in sync with %s\n", to, from)
+		return nil
+	}
+
+	if len(plan.Missing) > 0 {
+		fmt.Printf("\nMissing on %s:\n", to)
+		for _, update := range plan.Missing {
+			fmt.Printf("  %s (%s)\n", update.Ref, update.SHA[:7])
+		}
+	}
+
+	needsForce := 0
+	if len(plan.Diverged) > 0 {
+		fmt.Printf("\nDifferent on %s:\n", to)
+		for _, update := range plan.Diverged {
+			kind := "fast-forward"
+			if !update.FastForward {
+				kind = "needs force"
+				needsForce++
+			}
+			fmt.Printf("  %s (%s -> %s, %s)\n", update.Ref, update.OldSHA[:7], update.SHA[:7], kind)
+		}
+	}
+
+	allowForce := false
+	if needsForce > 0 {
+		// Overwriting remote refs never happens just by pressing Enter
+		confirm.defaultYes = false
+		allowForce = confirm.ask(fmt.Sprintf("\nForce-update %d ref(s) on %s to match %s?", needsForce, to, from))
+	}
+
+	return gitOp.Reconcile(plan, allowForce)
+}
+
+func handleDryRunDiff(gitOp *git.GitOperation) error {
+	pending, err := gitOp.PendingPushes()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		fmt.Printf("\n%s:\n", p.RemoteName)
+		switch {
+		case p.Err != nil:
+			fmt.Printf("  unable to compare: %v\n", p.Err)
+			continue
+		case !p.RemoteHasBranch:
+			fmt.Printf("  %s does not exist on %s yet, it will be created\n", p.Branch, p.RemoteName)
+		case len(p.Commits) == 0:
+			fmt.Printf("  nothing to push, %s/%s is up to date\n", p.RemoteName, p.Branch)
+		}
+		if p.Behind > 0 {
+			fmt.Printf("  %s/%s has %d commit(s) you don't have, a normal push will be rejected\n", p.RemoteName, p.Branch, p.Behind)
+		}
+
+		if len(p.Commits) > 0 {
+			fmt.Printf("  %d new commit(s):\n", len(p.Commits))
+			for _, commit := range p.Commits {
+				fmt.Printf("    %s\n", commit)
+			}
+		}
+		if p.DiffStat != "" {
+			fmt.Printf("  %s\n", p.DiffStat)
+		}
+	}
+	return nil
+}
+
+func handleOpenPR(gitOp *git.GitOperation, results []git.MirrorResult, base string) error {
+	branch, err := gitOp.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+	if base == "" {
+		if base, err = gitOp.DefaultBranch(); err != nil {
+			return err
+		}
+	}
+	if branch == "" || branch == base {
+		return fmt.Errorf("no pull request to open: the current branch is %s", base)
+	}
+
+	remotes, err := gitOp.Remotes()
+	if err != nil {
+		return err
+	}
+	pushed := map[string]bool{}
+	for _, result := range results {
+		pushed[result.RemoteName] = result.Success
+	}
+
+	fmt.Printf("\nPull requests for %s into %s:\n", branch, base)
+	for _, remote := range remotes {
+		if !pushed[remote.Name] {
+			continue
+		}
+		url, existed, err := gitOp.OpenPullRequest(remote, branch, base)
+		switch {
+		case err != nil:
+			fmt.Printf("  %s: %v\n", remote.Name, err)
+		case existed:
+			fmt.Printf("  %s: already open at %s\n", remote.Name, url)
+		default:
+			fmt.Printf("  %s: %s\n", remote.Name, url)
+		}
+	}
+	return nil
+}
+
+func checkSubmodules(gitOp *git.GitOperation) error {
+	problems, err := gitOp.SubmoduleProblems()
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	fmt.Println("\nSubmodules out of sync:")
+	for _, problem := range problems {
+		fmt.Printf("  %s: %s\n", problem.Path, problem.Problem)
+	}
+	return fmt.Errorf("%d submodule(s) don't match the recorded commits, run 'git submodule update --init --recursive' (or commit the new submodule commits) before pushing", len(problems))
+}
+
+func handleGC(gitOp *git.GitOperation, thresholdMB int) error {
+	before, err := gitOp.RepoStats()
+	if err != nil {
+		return err
+	}
+	if !before.NeedsGC(thresholdMB) {
+		fmt.Printf("Skipping gc: %s in %d loose object(s) and %d pack(s), below the threshold\n", git.FormatKiB(before.LooseKiB), before.LooseObjects, before.Packs)
+		return nil
+	}
+
+	fmt.Printf("Running git gc (%s in %d loose object(s), %d pack(s))...\n", git.FormatKiB(before.LooseKiB), before.LooseObjects, before.Packs)
+	if err := gitOp.GC(); err != nil {
+		return err
+	}
+
+	after, err := gitOp.RepoStats()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Repository size: %s -> %s\n", git.FormatKiB(before.TotalKiB()), git.FormatKiB(after.TotalKiB()))
+	return nil
+}
+
+func handleRecursive(root string, jobs int, wait bool, gitOptions git.Options, pushOpts git.PushOptions, forceConfirmed bool) int {
+	repos, err := git.FindRepos(root)
+	if err != nil {
+		fmt.Println(err)
+		return exitFailure
+	}
+	if len(repos) == 0 {
+		fmt.Printf("No git repositories found under %s\n", root)
+		return 0
+	}
+	if !forceConfirmed {
+		if err := confirmRecursiveForce(root, repos, pushOpts); err != nil {
+			fmt.Println(err)
+			return exitFailure
+		}
+	}
+	fmt.Printf("Pushing %d repositories under %s, %d at a time\n", len(repos), root, jobs)
+
+	type repoResult struct {
+		name    string
+		results []git.MirrorResult
+		err     error
+	}
+	outcomes := make([]repoResult, len(repos))
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, jobs)
+	for i, repo := range repos {
+		wg.Add(1)
+		go func(i int, repo string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			name, err := filepath.Rel(root, repo)
+			if err != nil || name == "." {
+				name = filepath.Base(repo)
+			}
+			repoOp := git.NewGitOperation(log.New(os.Stdout, "["+name+"] ", log.LstdFlags))
+			repoOp.SetOptions(gitOptions)
+			repoOp.SetDir(repo)
+
+			release, err := repoOp.AcquireLock(wait)
+			if err != nil {
+				outcomes[i] = repoResult{name: name, err: err}
+				return
+			}
+			defer release()
+
+			results, err := repoOp.Push(pushOpts)
+			outcomes[i] = repoResult{name: name, results: results, err: err}
+		}(i, repo)
+	}
+	wg.Wait()
+
+	code := 0
+	fmt.Printf("\n%-40s %s\n", "REPOSITORY", "RESULT")
+	for _, outcome := range outcomes {
+		result := colorize(colorGreen, git.CompactSummary(outcome.results))
+		if outcome.err != nil {
+			code = exitFailure
+			result = colorize(colorRed, git.CompactSummary(outcome.results))
+			if len(outcome.results) == 0 {
+				result = colorize(colorRed, fmt.Sprintf("error: %v", outcome.err))
+			}
+		}
+		fmt.Printf("%-40s %s\n", outcome.name, result)
+	}
+	return code
+}
+
+func handleDoctor(gitOp *git.GitOperation) int {
+	code := 0
+	for _, check := range gitOp.Doctor() {
+		status := fmt.Sprintf("%-4s", check.Status)
+		switch check.Status {
+		case git.CheckOK:
+			status = colorize(colorGreen, status)
+		case git.CheckWarn:
+			status = colorize(colorYellow, status)
+		case git.CheckFail:
+			status = colorize(colorRed, status)
+		}
+		fmt.Printf("[%s] %-24s %s\n", status, check.Name, check.Detail)
+		if check.Status == git.CheckFail {
+			code = exitFailure
+		}
+	}
+	return code
+}
+
+func handleReportDrift(gitOp *git.GitOperation) int {
+	heads, err := gitOp.ReportDrift()
+	if err != nil {
+		fmt.Println(err)
+		return exitFailure
+	}
+
+	code := 0
+	fmt.Printf("%-12s %-20s %-12s %s\n", "REMOTE", "DEFAULT BRANCH", "SHA", "STATUS")
+	for _, head := range heads {
+		status := colorize(colorGreen, "in sync")
+		switch {
+		case head.Err != nil:
+			status = colorize(colorRed, fmt.Sprintf("error: %v", head.Err))
+			code = exitFailure
+		case head.Canonical:
+			status = "canonical"
+		case head.Unknown:
+			status = colorize(colorYellow, "unknown (nothing to compare with)")
+		case head.Drifted:
+			status = colorize(colorYellow, "DRIFT")
+			if code == 0 {
+				code = exitDrift
+			}
+		}
+
+		sha := head.SHA
+		if len(sha) > 10 {
+			sha = sha[:10]
+		}
+		if sha == "" {
+			sha = "-"
+		}
+		fmt.Printf("%-12s %-20s %-12s %s\n", head.RemoteName, head.Branch, sha, status)
+	}
+	return code
+}
+
+func handleStatus(gitOp *git.GitOperation) int {
+	statuses, err := gitOp.MirrorStatus()
 	if err != nil {
-		return err
+		fmt.Println(err)
+		return exitFailure
 	}
 
-	if !hasChanges {
-		fmt.Println("No changes to commit")
-		return nil
+	code := 0
+	fmt.Printf("%-12s %-20s %-7s %-7s %s\n", "REMOTE", "BRANCH", "AHEAD", "BEHIND", "STATE")
+	for _, status := range statuses {
+		ahead, behind := strconv.Itoa(status.Ahead), strconv.Itoa(status.Behind)
+		state := colorize(colorGreen, "in sync")
+		switch {
+		case status.Err != nil:
+			ahead, behind = "-", "-"
+			state = colorize(colorRed, fmt.Sprintf("error: %v", status.Err))
+			code = exitFailure
+		case status.Missing:
+			ahead, behind = "-", "-"
+			state = colorize(colorYellow, "not on remote")
+		case status.Ahead > 0 && status.Behind > 0:
+			state = colorize(colorRed, "diverged")
+		case status.Ahead > 0:
+			state = colorize(colorYellow, "ahead")
+		case status.Behind > 0:
+			state = colorize(colorYellow, "behind")
+		}
+		fmt.Printf("%-12s %-20s %-7s %-7s %s\n", status.RemoteName, status.Branch, ahead, behind, state)
 	}
+	return code
+}
 
-	fmt.Println("\nCurrent git status:")
-	if err := gitOp.ShowStatus(); err != nil {
-		return err
+func handleListRemotes(gitOp *git.GitOperation) int {
+	listings, err := gitOp.ListRemotes()
+	if err != nil {
+		fmt.Println(err)
+		return exitFailure
 	}
 
-	commit := readUserInput("\nWould you like to commit these changes? [y/N]: ")
-	if strings.ToLower(commit) != "y" {
-		return fmt.Errorf("changes must be committed before pushing. Operation cancelled")
+	fmt.Printf("%-12s %-50s %s\n", "REMOTE", "URL", "GIT REMOTE")
+	for _, listing := range listings {
+		state := colorize(colorGreen, "added")
+		switch {
+		case listing.GitURL == "":
+			state = colorize(colorYellow, "not added yet, the next push adds it")
+		case listing.GitURL != listing.URL:
+			state = colorize(colorYellow, fmt.Sprintf("points at %s, the next push updates it", listing.GitURL))
+		}
+		fmt.Printf("%-12s %-50s %s\n", listing.Name, listing.URL, state)
 	}
+	return 0
+}
 
-	message := readUserInput("Enter commit message: ")
-	if message == "" {
-		return fmt.Errorf("commit message cannot be empty")
+func main() {
+	// Parse command line flags
+	forcePush := flag.Bool("force", false, "Force push to remotes, overwriting whatever is there")
+	forceWithLease := flag.Bool("force-with-lease", false, "Force push, but only if the remotes haven't moved since they were fetched")
+	pruneRemotes := flag.Bool("prune-remotes", false, "Remove git remotes that are no longer in the config before pushing")
+	showStatus := flag.Bool("status", false, "Show whether the current branch is ahead of, behind or diverged from every remote and exit")
+	listRemotes := flag.Bool("list-remotes", false, "List the configured remotes with their URLs and whether git knows them, and exit")
+	skipForceConfirm := flag.Bool("yes", false, "Commit and force push without asking first, for scripts")
+	var commitMessage string
+	flag.StringVar(&commitMessage, "message", "", "Commit with this message instead of asking for one")
+	flag.StringVar(&commitMessage, "m", "", "Short for --message")
+	messageFile := flag.String("message-file", "", "Commit with the message in this file, body and footer included")
+	forceNoFetch := flag.Bool("force-no-fetch", false, "Allow --force without fetching the remotes first")
+	chunkSize := flag.Int("chunk-size", 0, "Commit and push the staged files in chunks of at most N files")
+	restore := flag.Bool("restore", false, "Return to the starting branch (or commit, if HEAD was detached) when done")
+	resolveStrategy := flag.String("resolve-strategy", git.ResolveAbort, "How to handle conflicts when pulling: abort, ours, theirs or manual")
+	noSync := flag.Bool("no-sync", false, "Skip fetching and pulling from the remotes before pushing")
+	autostash := flag.Bool("autostash", false, "Stash uncommitted changes before pulling and restore them afterwards")
+	rebase := flag.Bool("rebase", false, "Rebase onto the remote commits when pulling instead of merging them (sync_strategy rebase)")
+	ffOnly := flag.Bool("ff-only", false, "Only pull when your branch can be fast-forwarded, never merge (sync_strategy ff-only)")
+	allowUnrelated := flag.Bool("allow-unrelated", false, "Let the pull merge remote histories that share no commit with the local branch")
+	editMessage := flag.Bool("edit", false, "Write the commit message in your editor")
+	commitVerbose := flag.Bool("commit-verbose", false, "Show the diff below the message in the editor (implies --edit)")
+	issue := flag.String("issue", "", "Add a 'Refs: <issue>' trailer to the commit, e.g. PROJ-123")
+	noValidateMessage := flag.Bool("no-validate-message", false, "Commit even if the message doesn't match commit_message_pattern")
+	lintMessage := flag.Bool("lint-message", false, "Check the commit message against the message rules and ask again if it breaks them")
+	messageFromBranch := flag.Bool("message-from-branch", false, "Offer a commit message derived from the branch name as the default")
+	preset := flag.String("preset", "", "Use the named commit message preset from the config")
+	selectMode := flag.Bool("select", false, "Choose which changed files to commit by number")
+	amend := flag.Bool("amend", false, "Fold the changes into the last commit instead of making a new one")
+	files := flag.String("files", "", "Comma-separated files to commit instead of all changes")
+	exclude := flag.String("exclude", "", "Comma-separated pathspecs to leave out of the commit, e.g. 'dist,*.log'")
+	branch := flag.String("branch", "", "Push this local branch to every remote instead of the checked-out one")
+	newBranch := flag.String("new-branch", "", "Create this branch from the current commit and switch to it before committing and pushing")
+	forceBranch := flag.Bool("force-branch", false, "Let --new-branch reset a branch that already exists")
+	remoteList := flag.String("remote", "", "Only sync with and push to these comma-separated remotes")
+	branchList := flag.String("branches", "", "Push these comma-separated local branches to every remote instead of the checked-out one")
+	mirror := flag.Bool("mirror", false, "Push every local branch and tag to every remote, deleting the ones that don't exist locally")
+	sequential := flag.Bool("sequential", false, "Push to one remote after the other, in config order, instead of all at once")
+	onlyIfAhead := flag.Bool("only-if-ahead", false, "Skip remotes that are not behind the current branch")
+	setupMode := flag.Bool("setup", false, "Run setup configuration")
+	recursive := flag.String("recursive", "", "Push every git repository found under this directory (no sync, commit or merge)")
+	jobs := flag.Int("jobs", 4, "How many repositories --recursive pushes at the same time")
+	wait := flag.Bool("wait", false, "Wait for another run in the same repository to finish instead of exiting")
+	noWait := flag.Bool("no-wait", false, "Exit right away if another run holds the repository lock (default)")
+	continueOp := flag.Bool("continue", false, "Finish a merge or rebase that was interrupted by conflicts, then exit")
+	abortOp := flag.Bool("abort", false, "Abort a merge or rebase that was interrupted by conflicts, then exit")
+	retryFailed := flag.Bool("retry-failed", false, "Only push to the remotes that failed in the previous run")
+	sign := flag.Bool("sign", false, "GPG-sign the commit and merge commits the tool makes (git commit -S)")
+	dryRun := flag.Bool("dry-run", false, "Log the git commands that would change something instead of running them")
+	dryRunDiff := flag.Bool("dry-run-diff", false, "Show the commits each remote would receive and exit without pushing")
+	reportDrift := flag.Bool("report-drift", false, "Compare the default branch of every remote and exit non-zero if they differ")
+	openPR := flag.Bool("open-pr", false, "Open a pull/merge request for the pushed branch on GitHub and GitLab")
+	prBase := flag.String("base", "", "Target branch for --open-pr (default: your default branch)")
+	checkSubs := flag.Bool("check-submodules", false, "Refuse to push when submodules are not at their recorded commits")
+	runGC := flag.Bool("gc", false, "Run git gc before pushing when the repository has piled up loose objects or packs")
+	gcThreshold := flag.Int("gc-threshold", 50, "Size of loose objects in MB that makes --gc run")
+	doctor := flag.Bool("doctor", false, "Check the installation, config and remotes for common problems and exit")
+	setRemoteHead := flag.Bool("set-remote-head", false, "Point each remote's HEAD at your default branch when it differs")
+	reconcile := flag.Bool("reconcile", false, "Catch a lagging remote up with another: --reconcile from=<remote> to=<remote>")
+	createMissing := flag.Bool("create-missing", false, "Create backup repositories that don't exist yet, locally or through the GitHub/GitLab API")
+	pushTags := flag.Bool("tags", false, "Also push local tags to every remote")
+	tag := flag.String("tag", "", "Push only this tag to every remote (implies --tags)")
+	tagPattern := flag.String("tag-pattern", "", "Only push tags matching this pattern, e.g. 'v*' (implies --tags)")
+	verifyTags := flag.Bool("verify-tags", false, "Only push tags whose signature passes 'git tag -v' (implies --tags)")
+	tagOnPush := flag.Bool("tag-on-push", false, "Create a local mirrored/<remote>/<branch>/<timestamp> tag after each successful push")
+	pushMirrorTags := flag.Bool("push-mirror-tags", false, "Also push the tags created by --tag-on-push to their remote")
+	defaultYes := flag.Bool("default-yes", false, "Treat pressing Enter at the commit and merge questions as yes")
+	cleanup := flag.Bool("cleanup", false, "Remove remotes and backup repositories left behind by failed pushes and exit")
+	pruneMirrorTags := flag.Bool("prune-mirror-tags", false, "Delete the local tags created by --tag-on-push and exit")
+	respectInsteadOf := flag.Bool("respect-insteadof", false, "Store remote URLs in their url.<base>.insteadOf short form")
+	healthExit := flag.Bool("health-exit-code", false, "Exit with a code describing why a push failed (for monitoring)")
+	colorMode := flag.String("color", "auto", "Color the reports: auto (terminal outside CI), always or never")
+	verbose := flag.Bool("verbose", false, "Log more detail about what is being done")
+	fetchJobs := flag.Int("fetch-jobs", 0, "Fetch this many remotes in parallel (git fetch --jobs)")
+	trace := flag.Bool("trace", false, "Run git commands with GIT_TRACE=1")
+	exportEnv := flag.Bool("export-env", false, "Print the config as GMP_* shell exports (secrets left out) and exit")
+	dashboard := flag.Bool("dashboard", false, "Show a live table of every remote's sync status (needs a build with -tags dashboard)")
+	dashboardInterval := flag.Duration("dashboard-interval", 30*time.Second, "How often --dashboard refreshes")
+	explainConfig := flag.Bool("explain-config", false, "Print every config value with the source it came from and exit")
+	printEnv := flag.Bool("print-env", false, "Print the environment git commands run with and exit")
+	metricsFile := flag.String("metrics-file", "", "Write Prometheus textfile metrics to this path after pushing")
+	compactSummary := flag.Bool("compact-summary", false, "Finish with a single line of remote:status tokens")
+	timeout := flag.Duration("timeout", 5*time.Minute, "Stop a fetch, pull or push that takes longer than this (0 for no limit)")
+	retries := flag.Int("retries", 0, "Retry a push that failed on a network error this many times")
+	retryDelay := flag.Duration("retry-delay", 2*time.Second, "Wait this long before the first retry, doubling after each one")
+	prePush := flag.String("pre-push", "", "Run this shell command before pushing and stop if it fails (overrides pre_push_command)")
+	quiet := flag.Bool("quiet", false, "Only print warnings and errors, e.g. for cron jobs (same as --log-level warn)")
+	logLevelName := flag.String("log-level", "info", "How much to log: debug (every git command), info, warn or error")
+	jsonOutput := flag.Bool("json", false, "Send the usual output to stderr and finish with a JSON report on stdout")
+	flag.Parse()
+
+	// With --json stdout only carries the report, everything else is
+	// printed on stderr
+	jsonOut := os.Stdout
+	if *jsonOutput {
+		os.Stdout = os.Stderr
 	}
 
-	if err := gitOp.Commit(message); err != nil {
-		return err
+	// Setup logging
+	logLevel, levelErr := parseLogLevel(*logLevelName)
+	if *quiet && logLevel < levelWarn {
+		logLevel = levelWarn
+	}
+	logger := newCLILogger(os.Stdout, logLevel)
+	if levelErr != nil {
+		logger.Fatal(levelErr)
 	}
 
-	fmt.Println("Changes committed successfully")
-	return nil
-}
+	// Everything printed directly is informational, --quiet drops it.
+	// Questions and the editor still need the terminal
+	terminal := os.Stdout
+	promptOut = terminal
+	if logLevel > levelInfo {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		os.Stdout = devNull
+	}
 
-func handleMerge(gitOp *git.GitOperation) error {
-	// Get list of branches first
-	branches, err := gitOp.ListBranches()
-	if err != nil {
-		return err
+	switch *resolveStrategy {
+	case git.ResolveAbort, git.ResolveOurs, git.ResolveTheirs, git.ResolveManual:
+	default:
+		logger.Fatalf("Unknown --resolve-strategy '%s', expected abort, ours, theirs or manual", *resolveStrategy)
 	}
 
-	currentBranch, err := gitOp.GetCurrentBranch()
-	if err != nil {
-		return err
+	if err := setupColor(*colorMode); err != nil {
+		logger.Fatal(err)
 	}
 
-	// Filter out current branch from available branches
-	availableBranches := []string{}
-	for _, branch := range branches {
-		if branch != currentBranch {
-			availableBranches = append(availableBranches, branch)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "chunk-size" && *chunkSize <= 0 {
+			logger.Fatal("--chunk-size must be greater than 0")
 		}
-	}
+		if f.Name == "jobs" && *jobs <= 0 {
+			logger.Fatal("--jobs must be greater than 0")
+		}
+		if f.Name == "fetch-jobs" && *fetchJobs <= 0 {
+			logger.Fatal("--fetch-jobs must be greater than 0")
+		}
+		if f.Name == "timeout" && *timeout < 0 {
+			logger.Fatal("--timeout can't be negative")
+		}
+		if f.Name == "retries" && *retries < 0 {
+			logger.Fatal("--retries can't be negative")
+		}
+		if f.Name == "retry-delay" && *retryDelay <= 0 {
+			logger.Fatal("--retry-delay must be greater than 0")
+		}
+	})
 
-	// If no other branches available, skip merge prompt
-	if len(availableBranches) == 0 {
-		fmt.Println("\nNo other branches available for merging.")
-		return nil
+	var commitExclude []string
+	for _, pathspec := range strings.Split(*exclude, ",") {
+		if pathspec = strings.TrimSpace(pathspec); pathspec != "" {
+			commitExclude = append(commitExclude, pathspec)
+		}
 	}
 
-	// Ask if user wants to merge
-	fmt.Printf("\nCurrent branch: %s\n", currentBranch)
-	merge := readUserInput("Would you like to merge your changes? [y/N]: ")
-	if strings.ToLower(merge) != "y" {
-		return nil
+	// Initialize git operations
+	gitOptions := git.Options{
+		Trace:                 *trace,
+		Verbose:               *verbose || logLevel == levelDebug,
+		FetchJobs:             *fetchJobs,
+		DryRun:                *dryRun,
+		Sign:                  *sign,
+		Timeout:               *timeout,
+		Debug:                 logLevel == levelDebug,
+		SkipMessageValidation: *noValidateMessage,
+		CommitExclude:         commitExclude,
+		Terminal:              terminal,
+		MessageFile:           *messageFile,
 	}
+	gitOp := git.NewGitOperation(logger.Logger)
+	gitOp.SetWarningLogger(logger.warnings)
+	gitOp.SetOptions(gitOptions)
 
-	// Show available branches
-	fmt.Println("\nAvailable branches:")
-	for i, branch := range availableBranches {
-		fmt.Printf("%d: %s\n", i+1, branch)
+	var lastResults []git.MirrorResult
+	reportJSON := func(errs ...string) {
+		branch, _ := gitOp.GetCurrentBranch()
+		if err := writeJSONReport(jsonOut, newJSONReport(branch, lastResults, errs)); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write the JSON report: %v\n", err)
+		}
+	}
+	if *jsonOutput {
+		logger.beforeExit = func(message string) { reportJSON(message) }
 	}
 
-	// Get target branch
-	targetBranch := readUserInput("\nEnter the branch name to merge into: ")
-	found := false
-	for _, branch := range availableBranches {
-		if branch == targetBranch {
-			found = true
-			break
+	var pushBranches []string
+	for _, name := range strings.Split(*branchList, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			pushBranches = append(pushBranches, name)
 		}
 	}
-	if !found {
-		return fmt.Errorf("branch '%s' not found", targetBranch)
+	var selectedRemotes []string
+	for _, name := range strings.Split(*remoteList, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			selectedRemotes = append(selectedRemotes, name)
+		}
 	}
 
-	// Get commit message
-	message := readUserInput("Enter merge commit message: ")
-	if message == "" {
-		message = fmt.Sprintf("Merge branch '%s' into %s", currentBranch, targetBranch)
+	if len(pushBranches) > 0 && *branch != "" {
+		logger.Fatal("--branch and --branches both choose what to push, use one of them")
+	}
+	if *newBranch != "" && (*branch != "" || len(pushBranches) > 0) {
+		logger.Fatal("--new-branch pushes the new branch, it can't be combined with --branch or --branches")
+	}
+	if *newBranch != "" && (*retryFailed || *mirror) {
+		logger.Fatal("--new-branch can't be combined with --retry-failed or --mirror")
+	}
+	if *mirror && (*branch != "" || len(pushBranches) > 0) {
+		logger.Fatal("--mirror pushes every branch, it can't be combined with --branch or --branches")
+	}
+	if *mirror && (*pushTags || *tagPattern != "" || *verifyTags || *tag != "" || *tagOnPush || *pushMirrorTags) {
+		logger.Fatal("--mirror pushes every tag, it can't be combined with the tag options")
 	}
 
-	// Perform merge
-	if err := gitOp.MergeBranch(currentBranch, targetBranch, message); err != nil {
-		return err
+	pushOpts := git.PushOptions{
+		Force:            *forcePush,
+		ForceWithLease:   *forceWithLease,
+		ForceNoFetch:     *forceNoFetch,
+		OnlyIfAhead:      *onlyIfAhead,
+		RespectInsteadOf: *respectInsteadOf,
+		CreateMissing:    *createMissing,
+		TagOnPush:        *tagOnPush || *pushMirrorTags,
+		PushMirrorTags:   *pushMirrorTags,
+		PushTags:         *pushTags || *tagPattern != "" || *verifyTags || *tag != "",
+		TagPattern:       *tagPattern,
+		Tag:              *tag,
+		VerifyTags:       *verifyTags,
+		SetRemoteHead:    *setRemoteHead,
+		Sequential:       *sequential,
+		Branch:           *branch,
+		Branches:         pushBranches,
+		Mirror:           *mirror,
+		Only:             selectedRemotes,
+		PruneRemotes:     *pruneRemotes,
+		PrePush:          *prePush,
+		Retries:          *retries,
+		RetryDelay:       *retryDelay,
 	}
 
-	fmt.Printf("Successfully merged '%s' into '%s'\n", currentBranch, targetBranch)
-	return nil
-}
+	// Check git installation
+	if err := gitOp.CheckGitInstalled(); err != nil {
+		logger.Fatal(err)
+	}
 
-func main() {
-	// Parse command line flags
-	forcePush := flag.Bool("force", false, "Force push to remotes")
-	setupMode := flag.Bool("setup", false, "Run setup configuration")
-	flag.Parse()
+	if *printEnv {
+		settings := gitOp.EffectiveEnv()
+		fmt.Println("Environment for git commands:")
+		if len(settings) == 0 {
+			fmt.Println("  (nothing relevant is set)")
+		}
+		for _, setting := range settings {
+			fmt.Printf("  %s=%s (%s)\n", setting.Name, setting.Value, setting.Source)
+		}
+		return
+	}
 
-	// Setup logging
-	logger := log.New(os.Stdout, "", log.LstdFlags)
+	if *explainConfig {
+		settings, err := gitOp.ExplainConfig()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Printf("%-22s %-40s %s\n", "KEY", "VALUE", "SOURCE")
+		for _, setting := range settings {
+			value := setting.Value
+			if value == "" {
+				value = "-"
+			}
+			fmt.Printf("%-22s %-40s %s\n", setting.Key, value, setting.Source)
+		}
+		return
+	}
 
-	// Initialize git operations
-	gitOp := git.NewGitOperation(logger)
+	if *doctor {
+		os.Exit(handleDoctor(gitOp))
+	}
 
-	// Check git installation
-	if err := gitOp.CheckGitInstalled(); err != nil {
-		logger.Fatal(err)
+	if *exportEnv {
+		exports, excluded, err := gitOp.ExportEnv()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Println("# git-multi-push configuration, generated by --export-env")
+		for _, export := range exports {
+			fmt.Printf("export %s=%s\n", export.Name, git.ShellQuote(export.Value))
+		}
+		fmt.Println("# Sensitive, not exported. Put these in your secret store if you use them:")
+		for _, name := range excluded {
+			fmt.Printf("#   %s\n", name)
+		}
+		return
 	}
 
 	// Handle setup mode
 	if *setupMode {
 		logger.Println("Starting setup configuration...")
 
+		configPath := gitOp.ConfigPath()
+		if _, err := os.Stat(configPath); err == nil {
+			fmt.Printf("\nA configuration already exists at %s\n", configPath)
+			overwrite := confirmation{words: git.DefaultConfirmWords}
+			if !overwrite.ask("Overwrite it?") {
+				logger.Println("Setup cancelled, the existing configuration was kept")
+				return
+			}
+		} else {
+			fmt.Printf("The configuration will be written to %s\n", configPath)
+		}
+
 		config := &git.Config{}
+		detectedRepo := detectRepoName(gitOp)
+
+		imported, err := selectGitRemotes(gitOp)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		config.Remotes = append(config.Remotes, imported...)
+		hasProvider := func(provider string) bool {
+			for _, remote := range imported {
+				if remote.Provider == provider {
+					return true
+				}
+			}
+			return false
+		}
+
+		// Providers taken over from the git remotes don't need asking again
+		if !hasProvider(git.ProviderGithub) {
+			fmt.Println("\nEnter GitHub information (press Enter to skip):")
+			fmt.Println("(Just the repository name, not the full URL)")
+			remote, err := askHostedRemote(git.ProviderGithub, "GitHub", "github.com", detectedRepo)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			if remote != nil {
+				config.Remotes = append(config.Remotes, *remote)
+			}
+		}
+
+		if !hasProvider(git.ProviderGitlab) {
+			fmt.Println("\nEnter GitLab information (press Enter to skip):")
+			remote, err := askHostedRemote(git.ProviderGitlab, "GitLab", "gitlab.com", detectedRepo)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			if remote != nil {
+				config.Remotes = append(config.Remotes, *remote)
+			}
+		}
 
-		fmt.Println("\nEnter GitHub information:")
-		fmt.Println("(Just the repository name, not the full URL)")
-		fmt.Print("GitHub username: ")
-		fmt.Scanln(&config.GithubUsername)
+		if !hasProvider(git.ProviderBitbucket) {
+			fmt.Println("\nEnter Bitbucket information (press Enter to skip):")
+			remote, err := askHostedRemote(git.ProviderBitbucket, "Bitbucket", "bitbucket.org", detectedRepo)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			if remote != nil {
+				config.Remotes = append(config.Remotes, *remote)
+			}
+		}
 
-		fmt.Print("GitHub repository name (e.g., 'repository-name'): ")
-		fmt.Scanln(&config.GithubRepo)
+		backupPath := readUserInput("\nLocal bare backup repository path (press Enter to skip): ")
+		if backupPath != "" {
+			config.Remotes = append(config.Remotes, git.Remote{Name: "backup", URL: backupPath})
+		}
 
-		fmt.Println("\nEnter GitLab information (press Enter to skip):")
-		fmt.Print("GitLab username: ")
-		fmt.Scanln(&config.GitlabUsername)
+		remoteNames := []string{}
+		for _, remote := range config.Remotes {
+			remoteNames = append(remoteNames, remote.Name)
+		}
+		if len(remoteNames) == 0 {
+			logger.Fatal("No remotes configured")
+		}
 
-		if config.GitlabUsername != "" {
-			fmt.Print("GitLab repository name: ")
-			fmt.Scanln(&config.GitlabRepo)
+		if len(remoteNames) > 1 {
+			names := strings.Join(remoteNames, "/")
+			fmt.Printf("\nPrimary remote to pull from (%s, press Enter to pull from all): ", names)
+			fmt.Scanln(&config.PrimaryRemote)
+			known := config.PrimaryRemote == ""
+			for _, name := range remoteNames {
+				known = known || name == config.PrimaryRemote
+			}
+			if !known {
+				logger.Fatalf("Unknown remote '%s', expected one of %s", config.PrimaryRemote, names)
+			}
 		}
 
 		// Confirm settings before saving
 		fmt.Println("\nConfiguration to be saved:")
-		fmt.Printf("GitHub: %s/%s\n", config.GithubUsername, config.GithubRepo)
-		if config.GitlabUsername != "" {
-			fmt.Printf("GitLab: %s/%s\n", config.GitlabUsername, config.GitlabRepo)
+		for _, remote := range config.Remotes {
+			switch {
+			case remote.URL == "" && remote.Protocol != "":
+				fmt.Printf("%s: %s/%s/%s over %s\n", remote.Name, remote.Host, remote.Username, remote.Repo, remote.Protocol)
+			case remote.URL == "":
+				fmt.Printf("%s: %s/%s/%s\n", remote.Name, remote.Host, remote.Username, remote.Repo)
+			case remote.Provider != "":
+				fmt.Printf("%s: %s (%s)\n", remote.Name, remote.URL, remote.Provider)
+			default:
+				fmt.Printf("%s: %s\n", remote.Name, remote.URL)
+			}
+		}
+		if config.PrimaryRemote != "" {
+			fmt.Printf("Primary remote: %s (other remotes are push-only)\n", config.PrimaryRemote)
 		}
 
-		fmt.Print("\nIs this correct? [Y/n]: ")
-		var confirm string
-		fmt.Scanln(&confirm)
-		if confirm != "" && strings.ToLower(confirm) != "y" {
+		confirm := confirmation{words: git.DefaultConfirmWords, defaultYes: true}
+		if !confirm.ask("\nIs this correct?") {
 			logger.Println("Setup cancelled")
 			return
 		}
@@ -181,34 +1627,437 @@ func main() {
 		return
 	}
 
+	if *recursive != "" {
+		forceConfirmed := !(*forcePush || *forceWithLease || *mirror) || *skipForceConfirm || *dryRun
+		os.Exit(handleRecursive(*recursive, *jobs, *wait && !*noWait, gitOptions, pushOpts, forceConfirmed))
+	}
+
 	// Check if we're in a git repository
 	isRepo, repoPath := gitOp.IsGitRepo()
 	if !isRepo {
 		logger.Fatal("Not in a git repository")
 	}
-	logger.Printf("Operating on git repository at: %s", repoPath)
+	logger.Infof("Operating on git repository at: %s", repoPath)
+
+	// The status and the dashboard only fetch and read, they don't need the lock
+	if *listRemotes {
+		os.Exit(handleListRemotes(gitOp))
+	}
+	if *showStatus {
+		os.Exit(handleStatus(gitOp))
+	}
+	if *dashboard {
+		if *dashboardInterval <= 0 {
+			logger.Fatal("--dashboard-interval must be positive")
+		}
+		os.Exit(runDashboard(gitOp, *dashboardInterval))
+	}
+
+	release, err := gitOp.AcquireLock(*wait && !*noWait)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer release()
+	// Fatal errors exit without running deferred calls
+	logger.atExit(release)
+	// Ctrl-C shouldn't leave the lock behind for the next run to clean up
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		release()
+		os.Exit(130)
+	}()
+
+	// Syncing or committing on top of a half-done merge or rebase only
+	// makes it harder to untangle
+	inProgress, err := gitOp.InProgressOperation()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if *continueOp || *abortOp {
+		if inProgress == "" {
+			fmt.Println("No merge or rebase in progress")
+			return
+		}
+		if *continueOp && *abortOp {
+			logger.Fatal("--continue and --abort can't be used together")
+		}
+		if *continueOp {
+			if err := gitOp.ContinueOperation(inProgress); err != nil {
+				logger.Fatal(err)
+			}
+			fmt.Printf("The %s is finished, run git-multi-push again to sync and push\n", inProgress)
+			return
+		}
+		if err := gitOp.AbortOperation(inProgress); err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Printf("The %s was aborted\n", inProgress)
+		return
+	}
+	if inProgress != "" {
+		logger.Fatalf("A %s is in progress in this repository. Resolve the conflicts and run with --continue, or run with --abort to undo it", inProgress)
+	}
+
+	issueRef := *issue
+	if issueRef == "" {
+		fromBranch, err := gitOp.IssueFromBranch()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		issueRef = fromBranch
+		if issueRef != "" {
+			fmt.Printf("Referencing issue %s from the branch name\n", issueRef)
+		}
+	}
+	if issueRef != "" {
+		if err := gitOp.ValidateIssue(issueRef); err != nil {
+			logger.Fatal(err)
+		}
+		gitOptions.CommitTrailers = []string{"Refs: " + issueRef}
+		gitOp.SetOptions(gitOptions)
+	}
+
+	confirm := confirmation{words: gitOp.ConfirmWords(), defaultYes: *defaultYes}
+
+	if *cleanup {
+		removed, err := gitOp.Cleanup()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if len(removed) == 0 {
+			fmt.Println("Nothing to clean up")
+		}
+		verb := "Removed"
+		if *dryRun {
+			verb = "Would remove"
+		}
+		for _, artifact := range removed {
+			fmt.Printf("%s %s %s\n", verb, artifact.Kind, artifact.Name)
+		}
+		return
+	}
+
+	if *pruneMirrorTags {
+		tags, err := gitOp.PruneMirrorTags()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Printf("Deleted %d mirror tag(s)\n", len(tags))
+		return
+	}
+
+	if *dryRunDiff {
+		if err := handleDryRunDiff(gitOp); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	if *reportDrift {
+		logger.Exit(handleReportDrift(gitOp))
+	}
+
+	if *reconcile {
+		from, to, err := parseReconcileArgs(flag.Args())
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if err := handleReconcile(gitOp, from, to, confirm); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	onlyRemotes := selectedRemotes
+	if len(selectedRemotes) > 0 {
+		if err := checkRemoteNames(gitOp, selectedRemotes); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if *retryFailed {
+		state, err := gitOp.LoadRunState()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if len(state.FailedRemotes) == 0 {
+			fmt.Println("No failed remotes to retry")
+			return
+		}
+		if branch, _ := gitOp.GetCurrentBranch(); state.Branch != "" && branch != state.Branch {
+			logger.Warnf("The failed push was for branch '%s', but '%s' is checked out", state.Branch, branch)
+		}
+		failed := state.FailedRemotes
+		if len(selectedRemotes) > 0 {
+			failed = []string{}
+			for _, name := range state.FailedRemotes {
+				for _, selected := range selectedRemotes {
+					if name == selected {
+						failed = append(failed, name)
+					}
+				}
+			}
+			if len(failed) == 0 {
+				fmt.Println("None of the failed remotes were chosen with --remote")
+				return
+			}
+		}
+		fmt.Printf("Retrying failed remotes: %s\n", strings.Join(failed, ", "))
+		onlyRemotes = failed
+	}
+
+	// Remember where we started so --restore can go back there
+	startRef, startDetached, err := gitOp.CurrentRef()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	// Committing on a detached HEAD leaves the commit on no branch, and
+	// there would be nothing to pull or push
+	if startDetached && *branch == "" && len(pushBranches) == 0 && !*mirror && *newBranch == "" {
+		logger.Fatalf("%v (or name the branch to push with --branch)", git.ErrDetachedHead)
+	}
+
+	if *checkSubs {
+		if err := checkSubmodules(gitOp); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	if *runGC {
+		if err := handleGC(gitOp, *gcThreshold); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
+
+	// Checked before syncing so a typo doesn't cost a round of fetches
+	var commitFiles []string
+	for _, file := range strings.Split(*files, ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			commitFiles = append(commitFiles, file)
+		}
+	}
+	if commitMessage != "" && *preset != "" {
+		logger.Fatal("--message and --preset both set the commit message, use one of them")
+	}
+	if *messageFile != "" {
+		if commitMessage != "" || *preset != "" {
+			logger.Fatal("--message-file, --message and --preset all set the commit message, use one of them")
+		}
+		if *chunkSize > 0 {
+			logger.Fatal("--message-file can't be combined with --chunk-size, which numbers the parts in the message")
+		}
+		// git commits the file itself with -F, the contents are only read
+		// to check them against the message rules
+		data, err := os.ReadFile(*messageFile)
+		if err != nil {
+			logger.Fatalf("failed to read --message-file: %v", err)
+		}
+		if commitMessage = strings.TrimSpace(string(data)); commitMessage == "" {
+			logger.Fatalf("--message-file %s is empty", *messageFile)
+		}
+	}
+	if len(commitFiles) > 0 && *selectMode {
+		logger.Fatal("--files and --select both choose the files to commit, use one of them")
+	}
+	if err := gitOp.ValidatePaths(commitFiles); err != nil {
+		logger.Fatal(err)
+	}
+	if *newBranch != "" {
+		if err := gitOp.CheckNewBranch(*newBranch, *forceBranch); err != nil {
+			logger.Fatal(err)
+		}
+	}
 
 	// Step 1: Sync with remotes
-	fmt.Println("Synchronizing with remotes...")
-	if err := gitOp.SyncWithRemotes(); err != nil {
-		logger.Printf("Warning: Failed to sync with remotes: %v", err)
-		// Continue anyway as this might be first push
+	syncOpts := git.SyncOptions{ResolveStrategy: *resolveStrategy, AllowUnrelated: *allowUnrelated, Only: onlyRemotes, Autostash: *autostash}
+	switch {
+	case *rebase && *ffOnly:
+		logger.Fatal("--rebase and --ff-only both choose how to pull, use one of them")
+	case *rebase:
+		syncOpts.Strategy = git.SyncRebase
+	case *ffOnly:
+		syncOpts.Strategy = git.SyncFFOnly
+	}
+	pull := !*retryFailed && !*noSync
+	remoteAhead := false
+	if pull {
+		if remoteAhead, err = printDivergence(gitOp, onlyRemotes); err != nil {
+			logger.Warnf("Could not check divergence: %v", err)
+		}
+	}
+	if remoteAhead {
+		// Pulling was always the default, keep it that way when pressing Enter
+		pullConfirm := confirmation{words: confirm.words, defaultYes: true}
+		if pull = pullConfirm.ask("\nPull the remote commits before pushing?"); !pull {
+			fmt.Println("Skipping the pull, consider --force or a rebase if the push is rejected")
+		}
+	}
+	if pull {
+		fmt.Println("Synchronizing with remotes...")
+		if err := gitOp.SyncWithRemotes(syncOpts); err != nil {
+			if errors.Is(err, git.ErrConflictsPending) {
+				logger.Fatal(err)
+			}
+			logger.Warnf("Failed to sync with remotes: %v", err)
+			// Continue anyway as this might be first push
+		}
+	}
+
+	// Branching off after the pull starts the branch from the synced commit,
+	// the remotes don't have it yet to pull from
+	if *newBranch != "" {
+		if err := gitOp.CreateBranch(*newBranch, *forceBranch); err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Printf("Switched to branch '%s' at the current commit\n", *newBranch)
+	}
+
+	forceConfirmed := !(*forcePush || *forceWithLease || *mirror) || *skipForceConfirm || *dryRun
+	// A failed push is reported here, exiting is left to the caller so the
+	// rest of the run (e.g. --restore) still happens
+	push := func() ([]git.MirrorResult, error) {
+		opts := pushOpts
+		opts.Only = onlyRemotes
+		if !forceConfirmed {
+			confirmPush := confirmForcePush
+			if opts.Mirror {
+				confirmPush = confirmMirrorPush
+			}
+			if err := confirmPush(gitOp, opts); err != nil {
+				logger.Fatal(err)
+			}
+			forceConfirmed = true
+		}
+		results, err := gitOp.Push(opts)
+		if *metricsFile != "" {
+			if err := git.WriteMetricsFile(*metricsFile, results); err != nil {
+				logger.Warnf("Failed to write metrics file: %v", err)
+			}
+		}
+		lastResults = results
+		if err != nil {
+			logger.Error(err)
+		}
+		if !*compactSummary {
+			printPushSummary(results)
+		}
+		// Only the checked-out branch is pushed at HEAD
+		if err == nil && !*compactSummary && !*dryRun && opts.Branch == "" && len(opts.Branches) == 0 && !opts.Mirror {
+			if err := printCommitLinks(gitOp, results); err != nil {
+				logger.Warnf("%v", err)
+			}
+		}
+		return results, err
+	}
+	pushFailed := func(results []git.MirrorResult, err error) {
+		if *compactSummary {
+			fmt.Println(git.CompactSummary(results))
+		}
+		if *jsonOutput {
+			reportJSON(err.Error())
+		}
+		if *healthExit {
+			logger.Exit(healthExitCode(results))
+		}
+		logger.Exit(exitFailure)
+	}
+
+	done := func() {
+		fmt.Println("Operations completed successfully")
+		if *compactSummary && lastResults != nil {
+			fmt.Println(git.CompactSummary(lastResults))
+		}
+		if *jsonOutput {
+			reportJSON()
+		}
+	}
+
+	// Retrying only repeats the push, the rest already happened last run
+	if *retryFailed {
+		if results, err := push(); err != nil {
+			pushFailed(results, err)
+		}
+		done()
+		return
+	}
+
+	commitOpts := commitOptions{
+		selectFiles: *selectMode,
+		files:       commitFiles,
+		edit:        *editMessage || *commitVerbose,
+		verbose:     *commitVerbose,
+		preset:      *preset,
+		message:     commitMessage,
+		lint:        *lintMessage || gitOp.MessageLintEnabled(),
+
+		messageFromBranch: *messageFromBranch,
+		confirm:           confirm,
+		amend:             *amend,
+		assumeYes:         *skipForceConfirm,
+	}
+
+	restoreStart := func() {
+		if !*restore {
+			return
+		}
+		currentRef, currentDetached, err := gitOp.CurrentRef()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if currentRef == startRef && currentDetached == startDetached {
+			return
+		}
+		if err := gitOp.RestoreRef(startRef, startDetached); err != nil {
+			logger.Fatal(err)
+		}
+		if startDetached {
+			fmt.Printf("Restored HEAD to commit %s; HEAD is detached again\n", startRef[:7])
+		} else {
+			fmt.Printf("Switched back to branch '%s'\n", startRef)
+		}
+	}
+
+	// Chunked mode commits and pushes the staged files piece by piece
+	if *chunkSize > 0 {
+		err := handleChunkedCommit(gitOp, *chunkSize, commitOpts, push)
+		restoreStart()
+		if errors.Is(err, errChunkPush) {
+			logger.Error(err)
+			pushFailed(lastResults, err)
+		}
+		if err != nil {
+			logger.Fatal(err)
+		}
+		done()
+		return
 	}
 
 	// Step 2: Handle commits if there are changes
-	if err := handleCommit(gitOp); err != nil {
+	if err := handleCommit(gitOp, commitOpts); err != nil {
 		logger.Fatal(err)
 	}
 
 	// Step 3: Handle merge if requested
-	if err := handleMerge(gitOp); err != nil {
+	remoteBranches, err := handleMerge(gitOp, confirm)
+	if err != nil {
 		logger.Fatal(err)
 	}
+	pushOpts.RemoteBranches = remoteBranches
 
 	// Step 4: Push to remotes
-	if err := gitOp.Push(*forcePush); err != nil {
-		logger.Fatal(err)
+	results, pushErr := push()
+	if pushErr == nil && *openPR && *dryRun {
+		logger.Infof("[dry-run] skipping --open-pr")
+	} else if pushErr == nil && *openPR {
+		if err := handleOpenPR(gitOp, results, *prBase); err != nil {
+			logger.Warnf("%v", err)
+		}
 	}
 
-	fmt.Println("Operations completed successfully")
+	restoreStart()
+	if pushErr != nil {
+		pushFailed(results, pushErr)
+	}
+	done()
 }
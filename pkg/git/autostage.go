@@ -0,0 +1,56 @@
+﻿package git
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+func (g *GitOperation) AutoStage() ([]string, error) {
+	if g.config == nil {
+		if err := g.LoadConfig(); err != nil {
+			return nil, nil
+		}
+	}
+	if len(g.config.AutoStage) == 0 {
+		return nil, nil
+	}
+
+	for _, pattern := range g.config.AutoStage {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+			return nil, fmt.Errorf("invalid auto_stage pattern '%s': %v", pattern, err)
+		}
+	}
+
+	files, err := g.ChangedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []string{}
+	for _, file := range files {
+		for _, pattern := range g.config.AutoStage {
+			if matchGlob(pattern, file) {
+				matched = append(matched, file)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+
+	if err := g.stage(matched); err != nil {
+		return nil, err
+	}
+	return matched, nil
+}
+
+func matchGlob(pattern, file string) bool {
+	// "dir/**" matches everything below dir, path.Match can't express that
+	if strings.HasSuffix(pattern, "/**") {
+		return strings.HasPrefix(file, strings.TrimSuffix(pattern, "**"))
+	}
+	matched, _ := path.Match(pattern, file)
+	return matched
+}
@@ -0,0 +1,67 @@
+﻿package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+type BranchMessage struct {
+	Template string `json:"template,omitempty"`
+	// Renames branch prefixes, e.g. "feature" to "feat"
+	Types map[string]string `json:"types,omitempty"`
+}
+
+func (g *GitOperation) MessageFromBranch() (string, error) {
+	branch, err := g.GetCurrentBranch()
+	if err != nil {
+		return "", err
+	}
+	if branch == "" {
+		return "", fmt.Errorf("HEAD is detached, there is no branch name to derive a message from")
+	}
+	if g.config == nil {
+		g.LoadConfig()
+	}
+	rules := BranchMessage{}
+	if g.config != nil {
+		rules = g.config.BranchMessage
+	}
+
+	// type/scope/slug, where type and scope are optional
+	parts := strings.Split(branch, "/")
+	branchType, scope := "", ""
+	slug := parts[len(parts)-1]
+	if len(parts) > 1 {
+		branchType = parts[0]
+		scope = strings.Join(parts[1:len(parts)-1], "/")
+	}
+	if alias, ok := rules.Types[branchType]; ok {
+		branchType = alias
+	}
+	words := strings.Join(strings.FieldsFunc(slug, func(r rune) bool {
+		return r == '-' || r == '_'
+	}), " ")
+
+	template := rules.Template
+	if template == "" {
+		switch {
+		case branchType != "" && scope != "":
+			template = "{type}({scope}): {words}"
+		case branchType != "":
+			template = "{type}: {words}"
+		default:
+			template = "{words}"
+		}
+	}
+
+	message := strings.TrimSpace(expandTemplate(template, map[string]string{
+		"type":   branchType,
+		"scope":  scope,
+		"words":  words,
+		"branch": branch,
+	}))
+	if message == "" {
+		return "", fmt.Errorf("could not derive a commit message from branch '%s'", branch)
+	}
+	return message, nil
+}
@@ -0,0 +1,133 @@
+﻿package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const configEnvPrefix = "GMP_"
+
+type EnvExport struct {
+	Name  string
+	Value string
+}
+
+var urlCredentials = regexp.MustCompile(`://[^/@\s"]+:[^/@\s"]+@`)
+
+// Secrets are never written to config.json, these are read from the
+// environment directly
+var sensitiveEnvVars = []string{"GITHUB_TOKEN", "GITLAB_TOKEN"}
+
+func configKeys() []string {
+	keys := []string{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+func configEnvName(key string) string {
+	return configEnvPrefix + strings.ToUpper(key)
+}
+
+func applyEnvOverrides(data []byte) ([]byte, bool, error) {
+	values := map[string]json.RawMessage{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, false, fmt.Errorf("invalid config format: %v", err)
+		}
+	}
+
+	stringKeys := map[string]bool{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		stringKeys[name] = t.Field(i).Type.Kind() == reflect.String
+	}
+
+	applied := false
+	for _, key := range configKeys() {
+		value, ok := os.LookupEnv(configEnvName(key))
+		if !ok {
+			continue
+		}
+		applied = true
+
+		// Lists and maps are given as JSON, plain strings as they are
+		if stringKeys[key] {
+			encoded, _ := json.Marshal(value)
+			values[key] = encoded
+			continue
+		}
+		if !json.Valid([]byte(value)) {
+			return nil, false, fmt.Errorf("%s must be valid JSON", configEnvName(key))
+		}
+		values[key] = json.RawMessage(value)
+	}
+	if !applied {
+		return data, false, nil
+	}
+
+	merged, err := json.Marshal(values)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to apply %s* variables: %v", configEnvPrefix, err)
+	}
+	return merged, true, nil
+}
+
+func (g *GitOperation) ExportEnv() ([]EnvExport, []string, error) {
+	if err := g.LoadConfig(); err != nil {
+		return nil, nil, err
+	}
+
+	data, err := json.Marshal(g.config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal config: %v", err)
+	}
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal config: %v", err)
+	}
+
+	exports := []EnvExport{}
+	excluded := []string{}
+	for _, key := range configKeys() {
+		raw, ok := values[key]
+		if !ok {
+			continue
+		}
+
+		value := string(raw)
+		var plain string
+		if json.Unmarshal(raw, &plain) == nil {
+			value = plain
+		}
+		if value == "" || value == "null" {
+			continue
+		}
+
+		name := configEnvName(key)
+		if redactValue(key, value) != value || urlCredentials.MatchString(value) {
+			excluded = append(excluded, name)
+			continue
+		}
+		exports = append(exports, EnvExport{Name: name, Value: value})
+	}
+
+	excluded = append(excluded, sensitiveEnvVars...)
+	sort.Strings(excluded)
+	return exports, excluded, nil
+}
+
+func ShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,76 @@
+﻿package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type ConfigSetting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// What applies when a key is set nowhere, for keys where that isn't obvious
+var configDefaults = map[string]string{
+	"mirror_tag_template":       defaultMirrorTagTemplate,
+	"default_branch":            "main, else master, else the current branch",
+	"issue_pattern":             defaultIssuePattern,
+	"confirm_words":             `["y","yes"]`,
+	"sign_commits":              "false",
+	"strict_config_permissions": "false",
+	"sync_strategy":             "merge",
+}
+
+func (g *GitOperation) ExplainConfig() ([]ConfigSetting, error) {
+	configPath := g.ConfigPath()
+	fileValues := map[string]json.RawMessage{}
+	if data, err := os.ReadFile(configPath); err == nil {
+		if err := json.Unmarshal(data, &fileValues); err != nil {
+			return nil, fmt.Errorf("invalid config format in %s: %v", configPath, err)
+		}
+	}
+
+	settings := []ConfigSetting{}
+	for _, key := range configKeys() {
+		setting := ConfigSetting{Key: key, Source: "default"}
+		if value, ok := os.LookupEnv(configEnvName(key)); ok {
+			setting.Value = value
+			setting.Source = "env " + configEnvName(key)
+		} else if raw, ok := fileValues[key]; ok {
+			setting.Value = displayJSON(raw)
+			setting.Source = "file " + configPath
+		} else {
+			setting.Value = configDefaults[key]
+		}
+
+		if redactValue(key, setting.Value) != setting.Value || urlCredentials.MatchString(setting.Value) {
+			setting.Value = "<redacted>"
+		}
+		settings = append(settings, setting)
+	}
+
+	for _, name := range sensitiveEnvVars {
+		setting := ConfigSetting{Key: name, Source: "not set"}
+		if _, ok := os.LookupEnv(name); ok {
+			setting.Value = "<redacted>"
+			setting.Source = "env " + name
+		}
+		settings = append(settings, setting)
+	}
+	return settings, nil
+}
+
+func displayJSON(raw json.RawMessage) string {
+	var plain string
+	if json.Unmarshal(raw, &plain) == nil {
+		return plain
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, raw) != nil {
+		return string(raw)
+	}
+	return compact.String()
+}
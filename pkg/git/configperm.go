@@ -0,0 +1,31 @@
+﻿package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// The config holds usernames and may hold tokens, only its owner needs it
+const configFileMode = 0600
+
+// Why the config file is too open, empty if it isn't. A repository's own
+// config is shared through git anyway, and Windows has no such mode bits
+func (g *GitOperation) configPermissionProblem(configPath string) string {
+	if runtime.GOOS == "windows" || configPath != filepath.Join(g.GetConfigDir(), "config.json") {
+		return ""
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return ""
+	}
+	mode := info.Mode().Perm()
+	switch {
+	case mode&0004 != 0:
+		return fmt.Sprintf("%s is readable by every user on this machine (mode %04o), run: chmod 600 %s", configPath, mode, ShellQuote(configPath))
+	case mode&^configFileMode != 0:
+		return fmt.Sprintf("%s has mode %04o, broader than 0600, run: chmod 600 %s", configPath, mode, ShellQuote(configPath))
+	}
+	return ""
+}
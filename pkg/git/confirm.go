@@ -0,0 +1,13 @@
+﻿package git
+
+var DefaultConfirmWords = []string{"y", "yes"}
+
+func (g *GitOperation) ConfirmWords() []string {
+	if g.config == nil {
+		g.LoadConfig()
+	}
+	if g.config == nil || len(g.config.ConfirmWords) == 0 {
+		return DefaultConfirmWords
+	}
+	return g.config.ConfirmWords
+}
@@ -0,0 +1,77 @@
+﻿package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+type DoctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+func (g *GitOperation) Doctor() []DoctorCheck {
+	checks := []DoctorCheck{}
+
+	if err := g.CheckGitInstalled(); err != nil {
+		return append(checks, DoctorCheck{"git", CheckFail, err.Error()})
+	}
+	version, _ := g.output("--version")
+	checks = append(checks, DoctorCheck{"git", CheckOK, strings.TrimSpace(string(version))})
+
+	isRepo, rootDir := g.IsGitRepo()
+	if !isRepo {
+		return append(checks, DoctorCheck{"repository", CheckFail, "not in a git repository"})
+	}
+	checks = append(checks, DoctorCheck{"repository", CheckOK, rootDir})
+
+	configPath := g.ConfigPath()
+	if err := g.LoadConfig(); err != nil {
+		return append(checks, DoctorCheck{"config", CheckFail, err.Error()})
+	}
+	checks = append(checks, DoctorCheck{"config", CheckOK, configPath})
+	if problem := g.configPermissionProblem(configPath); problem != "" {
+		checks = append(checks, DoctorCheck{"config permissions", CheckWarn, problem})
+	}
+
+	remotes, err := g.configuredRemotes(rootDir)
+	if err != nil {
+		return append(checks, DoctorCheck{"remotes", CheckFail, err.Error()})
+	}
+	if len(remotes) == 0 {
+		return append(checks, DoctorCheck{"remotes", CheckFail, "no remotes configured, run setup first"})
+	}
+
+	defaultBranch, err := g.DefaultBranch()
+	if err != nil {
+		return append(checks, DoctorCheck{"default branch", CheckFail, err.Error()})
+	}
+	checks = append(checks, DoctorCheck{"default branch", CheckOK, defaultBranch})
+
+	for _, remote := range remotes {
+		if isGitDaemonURL(remote.URL) {
+			checks = append(checks, DoctorCheck{fmt.Sprintf("remote %s protocol", remote.Name), CheckWarn, "git:// only accepts pushes if the daemon runs with --enable=receive-pack"})
+		}
+
+		name := fmt.Sprintf("remote %s HEAD", remote.Name)
+		head, err := g.remoteHeadBranch(remote)
+		switch {
+		case err != nil:
+			checks = append(checks, DoctorCheck{name, CheckFail, err.Error()})
+		case head == "":
+			checks = append(checks, DoctorCheck{name, CheckWarn, "not reported (empty repository?)"})
+		case head != defaultBranch:
+			checks = append(checks, DoctorCheck{name, CheckWarn, fmt.Sprintf("%s, expected %s (use --set-remote-head)", head, defaultBranch)})
+		default:
+			checks = append(checks, DoctorCheck{name, CheckOK, head})
+		}
+	}
+	return checks
+}
@@ -0,0 +1,85 @@
+﻿package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+type RemoteHead struct {
+	RemoteName string
+	Branch     string
+	SHA        string
+	Canonical  bool
+	Drifted    bool
+	// The canonical remote's HEAD couldn't be read, so there's nothing to
+	// compare with
+	Unknown bool
+	Err     error
+}
+
+// Asks the remote's URL, so remotes git doesn't know yet work too, with the
+// remote's own SSH key
+func (g *GitOperation) GetRemoteHead(remote Remote) (string, string, error) {
+	output, err := g.runRemote(remote.Name, "ls-remote", "--symref", remote.URL, "HEAD")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to query %s: %s", remote.Name, strings.TrimSpace(string(output)))
+	}
+
+	branch, sha := "", ""
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "ref:" && fields[2] == "HEAD":
+			branch = strings.TrimPrefix(fields[1], "refs/heads/")
+		case len(fields) == 2 && fields[1] == "HEAD":
+			sha = fields[0]
+		}
+	}
+	return branch, sha, nil
+}
+
+func (g *GitOperation) ReportDrift() ([]RemoteHead, error) {
+	isRepo, rootDir := g.IsGitRepo()
+	if !isRepo {
+		return nil, fmt.Errorf("not in a git repository")
+	}
+	if err := g.LoadConfig(); err != nil {
+		return nil, err
+	}
+
+	remotes, err := g.configuredRemotes(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(remotes) == 0 {
+		return nil, fmt.Errorf("no remotes configured, run setup first")
+	}
+
+	canonical := remotes[0].Name
+	if g.config.PrimaryRemote != "" {
+		canonical = g.config.PrimaryRemote
+	}
+
+	heads := []RemoteHead{}
+	canonicalSHA := ""
+	for _, remote := range remotes {
+		branch, sha, err := g.GetRemoteHead(remote)
+		head := RemoteHead{RemoteName: remote.Name, Branch: branch, SHA: sha, Canonical: remote.Name == canonical, Err: err}
+		if head.Canonical {
+			canonicalSHA = sha
+		}
+		heads = append(heads, head)
+	}
+
+	for i := range heads {
+		if heads[i].Err != nil || heads[i].Canonical {
+			continue
+		}
+		if canonicalSHA == "" {
+			heads[i].Unknown = true
+			continue
+		}
+		heads[i].Drifted = heads[i].SHA != canonicalSHA
+	}
+	return heads, nil
+}
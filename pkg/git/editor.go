@@ -0,0 +1,47 @@
+﻿package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+func (g *GitOperation) ResolveEditor() (string, error) {
+	// Same order git uses, so the editor matches a plain `git commit`
+	if editor := os.Getenv("GIT_EDITOR"); editor != "" {
+		return editor, nil
+	}
+	if output, err := g.output("config", "--get", "core.editor"); err == nil && strings.TrimSpace(string(output)) != "" {
+		return strings.TrimSpace(string(output)), nil
+	}
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); editor != "" {
+			return editor, nil
+		}
+	}
+
+	if !stdinIsTerminal() {
+		return "", fmt.Errorf("no editor configured and not running in a terminal; set GIT_EDITOR, core.editor, VISUAL or EDITOR, or commit without --edit")
+	}
+
+	defaults := []string{"nano", "vi"}
+	if runtime.GOOS == "windows" {
+		defaults = []string{"notepad"}
+	}
+	for _, editor := range defaults {
+		if _, err := exec.LookPath(editor); err == nil {
+			return editor, nil
+		}
+	}
+	return "", fmt.Errorf("no editor found (tried %s); set GIT_EDITOR, core.editor, VISUAL or EDITOR", strings.Join(defaults, ", "))
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,261 @@
+﻿package git
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Options struct {
+	Trace   bool
+	Verbose bool
+	// Passed to git fetch --all as --jobs, git's fetch.parallel applies if 0
+	FetchJobs int
+	// Added to every commit the tool makes, e.g. "Refs: PROJ-123"
+	CommitTrailers []string
+	// Log the commands that would change something instead of running them
+	DryRun bool
+	// Sign commits and merge commits (-S), also enabled by sign_commits
+	Sign bool
+	// Limit for each command that talks to a remote, 0 for none
+	Timeout time.Duration
+	// Log every git command with its arguments, and the output of the ones
+	// talking to a remote
+	Debug bool
+	// Let commit messages through that don't match commit_message_pattern
+	SkipMessageValidation bool
+	// Pathspecs left out of every commit, e.g. "dist" or "*.log"
+	CommitExclude []string
+	// Commits take their message from this file (git commit -F), so git's
+	// cleanup applies to it. The message passed in is only validated
+	MessageFile string
+	// Where git writes when it's handed the terminal, e.g. for the editor,
+	// os.Stdout if nil
+	Terminal *os.File
+}
+
+type EnvSetting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+var inheritedEnvVars = []string{
+	"GIT_SSH_COMMAND",
+	"GIT_SSH",
+	"GIT_SSH_VARIANT",
+	"SSH_AUTH_SOCK",
+	"GIT_ASKPASS",
+	"SSH_ASKPASS",
+	"GIT_TERMINAL_PROMPT",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"ALL_PROXY",
+	"NO_PROXY",
+	"http_proxy",
+	"https_proxy",
+	"all_proxy",
+	"no_proxy",
+	"GIT_CONFIG_PARAMETERS",
+	"GIT_CONFIG_GLOBAL",
+	"GIT_CONFIG_SYSTEM",
+	"GIT_TRACE",
+	"GIT_TRACE_PACKET",
+	"GIT_CURL_VERBOSE",
+}
+
+var gitConfigKeys = []string{
+	"core.sshCommand",
+	"core.askPass",
+	"http.proxy",
+	"https.proxy",
+	"credential.helper",
+}
+
+func (g *GitOperation) SetOptions(opts Options) {
+	g.options = opts
+}
+
+func (g *GitOperation) SetDir(dir string) {
+	g.dir = dir
+}
+
+func (g *GitOperation) resolvePath(path string) string {
+	if g.dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(g.dir, path)
+}
+
+// Reports whether a command has to be skipped because of --dry-run,
+// logging it in that case
+func (g *GitOperation) skipForDryRun(args ...string) bool {
+	if !g.options.DryRun {
+		return false
+	}
+	g.logger.Printf("[dry-run] git %s", quoteArgs(args))
+	return true
+}
+
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t'\"") {
+			quoted[i] = ShellQuote(arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (g *GitOperation) command(args ...string) *exec.Cmd {
+	return g.commandContext(context.Background(), args...)
+}
+
+func (g *GitOperation) commandContext(ctx context.Context, args ...string) *exec.Cmd {
+	if g.options.Debug {
+		g.logger.Printf("[debug] git %s", quoteArgs(args))
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dir
+	if env := g.extraEnv(); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+// The context for a command that talks to a remote, which ends after the
+// configured timeout
+func (g *GitOperation) remoteContext() (context.Context, context.CancelFunc) {
+	if g.options.Timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), g.options.Timeout)
+}
+
+func (g *GitOperation) remoteCommand(ctx context.Context, env []string, args ...string) *exec.Cmd {
+	cmd := g.commandContext(ctx, args...)
+	addEnv(cmd, env)
+	// ssh or a credential helper may outlive a killed git and hold on to
+	// its output
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
+
+// Later entries win, so these override the inherited ones
+func addEnv(cmd *exec.Cmd, env []string) {
+	if len(env) == 0 {
+		return
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, env...)
+}
+
+// Environment for commands talking to a remote: its own SSH key if the
+// config sets one, which takes precedence over an inherited GIT_SSH_COMMAND
+func (g *GitOperation) remoteEnv(remote string) []string {
+	if g.config == nil {
+		return nil
+	}
+	for _, configured := range g.config.Remotes {
+		if configured.Name == remote && configured.SSHKeyPath != "" {
+			key := expandHome(configured.SSHKeyPath)
+			return []string{"GIT_SSH_COMMAND=ssh -i " + ShellQuote(key) + " -o IdentitiesOnly=yes"}
+		}
+	}
+	return nil
+}
+
+func (g *GitOperation) extraEnv() []string {
+	env := []string{}
+	if g.options.Trace {
+		env = append(env, "GIT_TRACE=1")
+	}
+	return env
+}
+
+func (g *GitOperation) EffectiveEnv() []EnvSetting {
+	overrides := map[string]string{}
+	for _, entry := range g.extraEnv() {
+		name, value, _ := strings.Cut(entry, "=")
+		overrides[name] = value
+	}
+
+	settings := []EnvSetting{}
+	for _, name := range inheritedEnvVars {
+		if _, ok := overrides[name]; ok {
+			continue
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			settings = append(settings, EnvSetting{Name: name, Value: redactValue(name, value), Source: "inherited"})
+		}
+	}
+
+	// Config passed as GIT_CONFIG_COUNT/KEY/VALUE acts like -c overrides
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if name == "GIT_CONFIG_COUNT" || strings.HasPrefix(name, "GIT_CONFIG_KEY_") || strings.HasPrefix(name, "GIT_CONFIG_VALUE_") {
+			settings = append(settings, EnvSetting{Name: name, Value: redactValue(name, value), Source: "inherited"})
+		}
+	}
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		settings = append(settings, EnvSetting{Name: name, Value: redactValue(name, overrides[name]), Source: "set by git-multi-push"})
+	}
+
+	// Commands talking to a remote with its own SSH key get more on top.
+	// Without a config there are none
+	if g.config == nil {
+		g.LoadConfig()
+	}
+	if g.config != nil {
+		for _, remote := range g.config.Remotes {
+			for _, entry := range g.remoteEnv(remote.Name) {
+				name, value, _ := strings.Cut(entry, "=")
+				settings = append(settings, EnvSetting{Name: name, Value: redactValue(name, value), Source: "set by git-multi-push for " + remote.Name})
+			}
+		}
+	}
+
+	for _, key := range gitConfigKeys {
+		if output, err := g.output("config", "--get", key); err == nil {
+			settings = append(settings, EnvSetting{Name: key, Value: redactValue(key, strings.TrimSpace(string(output))), Source: "git config"})
+		}
+	}
+	return settings
+}
+
+func redactValue(name, value string) string {
+	lowerName := strings.ToLower(name)
+	for _, secret := range []string{"token", "password", "secret"} {
+		if strings.Contains(lowerName, secret) {
+			return "<redacted>"
+		}
+	}
+
+	// -c overrides may carry credentials in headers
+	lowerValue := strings.ToLower(value)
+	if strings.Contains(lowerValue, "extraheader") || strings.Contains(lowerValue, "authorization") {
+		return "<redacted>"
+	}
+
+	if parsed, err := url.Parse(value); err == nil && parsed.User != nil {
+		if _, hasPassword := parsed.User.Password(); hasPassword {
+			parsed.User = url.UserPassword(parsed.User.Username(), "redacted")
+			return parsed.String()
+		}
+	}
+	return value
+}
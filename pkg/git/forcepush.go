@@ -0,0 +1,59 @@
+﻿package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+type PushTarget struct {
+	RemoteName string
+	// What the remote ends up with, e.g. "main" or "main -> develop"
+	Refs string
+}
+
+// Lists what a push with these options overwrites on every remote, along
+// with the local branch being pushed (comma-separated for --branches)
+func (g *GitOperation) PushTargets(opts PushOptions) ([]PushTarget, string, error) {
+	isRepo, rootDir := g.IsGitRepo()
+	if !isRepo {
+		return nil, "", fmt.Errorf("not in a git repository")
+	}
+	if err := g.LoadConfig(); err != nil {
+		return nil, "", err
+	}
+
+	remotes, currentBranch, err := g.pushPlan(rootDir, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.Mirror {
+		targets := []PushTarget{}
+		for _, remote := range remotes {
+			targets = append(targets, PushTarget{RemoteName: remote.Name, Refs: "every branch and tag"})
+		}
+		return targets, "", nil
+	}
+
+	branches := []string{currentBranch}
+	if len(opts.Branches) > 0 {
+		branches = opts.Branches
+	} else if currentBranch == "" {
+		return nil, "", fmt.Errorf("HEAD is detached, check out the branch to force push")
+	}
+
+	targets := []PushTarget{}
+	for _, remote := range remotes {
+		for _, branch := range branches {
+			remoteBranch, refspecs := pushRefspecs(remote, opts.forBranch(branch), branch)
+			refs := branch
+			switch {
+			case len(remote.Refspecs) > 0:
+				refs = strings.Join(refspecs, ", ")
+			case remoteBranch != branch:
+				refs = branch + " -> " + remoteBranch
+			}
+			targets = append(targets, PushTarget{RemoteName: remote.Name, Refs: refs})
+		}
+	}
+	return targets, strings.Join(branches, ","), nil
+}
@@ -0,0 +1,62 @@
+﻿package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	OperationMerge      = "merge"
+	OperationRebase     = "rebase"
+	OperationCherryPick = "cherry-pick"
+	OperationRevert     = "revert"
+)
+
+var inProgressMarkers = []struct {
+	path      string
+	operation string
+}{
+	{"rebase-merge", OperationRebase},
+	{"rebase-apply", OperationRebase},
+	{"MERGE_HEAD", OperationMerge},
+	{"CHERRY_PICK_HEAD", OperationCherryPick},
+	{"REVERT_HEAD", OperationRevert},
+}
+
+func (g *GitOperation) InProgressOperation() (string, error) {
+	gitDir, err := g.GitDir()
+	if err != nil {
+		return "", err
+	}
+	for _, marker := range inProgressMarkers {
+		if _, err := os.Stat(filepath.Join(gitDir, marker.path)); err == nil {
+			return marker.operation, nil
+		}
+	}
+	return "", nil
+}
+
+// Reports whether a merge is waiting for its conflicts to be resolved
+func (g *GitOperation) HasMergeInProgress() bool {
+	operation, err := g.InProgressOperation()
+	return err == nil && operation == OperationMerge
+}
+
+func (g *GitOperation) ContinueOperation(operation string) error {
+	// Continuing may open the editor for the commit message
+	if err := g.runTerminal(nil, operation, "--continue"); err != nil {
+		return fmt.Errorf("failed to continue the %s, resolve the remaining conflicts and 'git add' them first: %v", operation, err)
+	}
+	return nil
+}
+
+func (g *GitOperation) AbortOperation(operation string) error {
+	if g.skipForDryRun(operation, "--abort") {
+		return nil
+	}
+	if output, err := g.run(operation, "--abort"); err != nil {
+		return fmt.Errorf("failed to abort the %s: %s", operation, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+﻿package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+type urlRewrite struct {
+	base   string
+	prefix string
+}
+
+func (g *GitOperation) insteadOfRules() []urlRewrite {
+	output, err := g.output("config", "--get-regexp", `^url\..*\.insteadof$`)
+	if err != nil {
+		// git config exits non-zero when nothing matches
+		return nil
+	}
+
+	rules := []urlRewrite{}
+	for _, line := range strings.Split(string(output), "\n") {
+		key, prefix, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok || !strings.HasPrefix(key, "url.") || !strings.HasSuffix(key, ".insteadof") {
+			continue
+		}
+		base := strings.TrimSuffix(strings.TrimPrefix(key, "url."), ".insteadof")
+		rules = append(rules, urlRewrite{base: base, prefix: prefix})
+	}
+	return rules
+}
+
+// Mirrors git's own rewrite: the longest matching insteadOf prefix wins
+func expandInsteadOf(url string, rules []urlRewrite) string {
+	best := -1
+	for i, rule := range rules {
+		if strings.HasPrefix(url, rule.prefix) && (best < 0 || len(rule.prefix) > len(rules[best].prefix)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return url
+	}
+	return rules[best].base + strings.TrimPrefix(url, rules[best].prefix)
+}
+
+func shortenInsteadOf(url string, rules []urlRewrite) string {
+	best := -1
+	for i, rule := range rules {
+		if strings.HasPrefix(url, rule.base) && (best < 0 || len(rule.base) > len(rules[best].base)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return url
+	}
+	return rules[best].prefix + strings.TrimPrefix(url, rules[best].base)
+}
+
+func (g *GitOperation) remoteURLForInsteadOf(name, url string) (string, bool) {
+	rules := g.insteadOfRules()
+	if len(rules) == 0 {
+		return url, false
+	}
+
+	// Keep an existing URL that git already rewrites to the one we want
+	if output, err := g.output("config", "--get", fmt.Sprintf("remote.%s.url", name)); err == nil {
+		existing := strings.TrimSpace(string(output))
+		if existing != url && expandInsteadOf(existing, rules) == url {
+			g.logger.Printf("Keeping %s URL %s, which git rewrites to %s", name, existing, url)
+			return existing, true
+		}
+	}
+
+	short := shortenInsteadOf(url, rules)
+	if short != url && expandInsteadOf(short, rules) == url {
+		g.logger.Printf("Using %s for %s so git's insteadOf rewrite applies", short, name)
+		return short, false
+	}
+	return url, false
+}
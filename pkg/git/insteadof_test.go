@@ -0,0 +1,45 @@
+﻿package git
+
+import "testing"
+
+func TestInsteadOf(t *testing.T) {
+	rules := []urlRewrite{
+		{base: "git@github.com:", prefix: "gh:"},
+		{base: "git@github.com:work/", prefix: "work:"},
+		{base: "https://gitlab.example.com/", prefix: "gl:"},
+	}
+
+	tests := []struct {
+		short string
+		long  string
+	}{
+		{"gh:user/repo.git", "git@github.com:user/repo.git"},
+		{"work:repo.git", "git@github.com:work/repo.git"},
+		{"gl:group/repo.git", "https://gitlab.example.com/group/repo.git"},
+		{"git@bitbucket.org:team/repo.git", "git@bitbucket.org:team/repo.git"},
+	}
+
+	for _, tt := range tests {
+		if got := expandInsteadOf(tt.short, rules); got != tt.long {
+			t.Errorf("expandInsteadOf(%q) = %q, want %q", tt.short, got, tt.long)
+		}
+		// The longest base wins, so work/ repositories get the work: prefix
+		if got := shortenInsteadOf(tt.long, rules); got != tt.short {
+			t.Errorf("shortenInsteadOf(%q) = %q, want %q", tt.long, got, tt.short)
+		}
+	}
+
+	if got := expandInsteadOf("gh:user/repo.git", nil); got != "gh:user/repo.git" {
+		t.Errorf("expandInsteadOf() without rules = %q, want it unchanged", got)
+	}
+}
+
+func TestInsteadOfLongestPrefix(t *testing.T) {
+	rules := []urlRewrite{
+		{base: "https://a.example.com/", prefix: "ex:"},
+		{base: "https://b.example.com/", prefix: "ex:b/"},
+	}
+	if got := expandInsteadOf("ex:b/repo.git", rules); got != "https://b.example.com/repo.git" {
+		t.Errorf("expandInsteadOf() = %q, want the longer prefix ex:b/ to win", got)
+	}
+}
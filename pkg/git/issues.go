@@ -0,0 +1,55 @@
+﻿package git
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Jira style keys such as PROJ-123
+const defaultIssuePattern = `[A-Z][A-Z0-9]+-[0-9]+`
+
+func (g *GitOperation) issuePattern() (*regexp.Regexp, error) {
+	pattern := defaultIssuePattern
+	if g.config != nil && g.config.IssuePattern != "" {
+		pattern = g.config.IssuePattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issue_pattern '%s': %v", pattern, err)
+	}
+	return re, nil
+}
+
+func (g *GitOperation) ValidateIssue(issue string) error {
+	if g.config == nil {
+		g.LoadConfig()
+	}
+	re, err := g.issuePattern()
+	if err != nil {
+		return err
+	}
+	if match := re.FindString(issue); match != issue {
+		return fmt.Errorf("'%s' is not a valid issue reference (expected %s)", issue, re.String())
+	}
+	return nil
+}
+
+func (g *GitOperation) IssueFromBranch() (string, error) {
+	if g.config == nil {
+		g.LoadConfig()
+	}
+	// Only look at branch names when the project asked for it
+	if g.config == nil || g.config.IssuePattern == "" {
+		return "", nil
+	}
+	re, err := g.issuePattern()
+	if err != nil {
+		return "", err
+	}
+
+	branch, err := g.GetCurrentBranch()
+	if err != nil {
+		return "", err
+	}
+	return re.FindString(branch), nil
+}
@@ -0,0 +1,91 @@
+﻿package git
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const defaultMaxSubjectLength = 72
+
+type MessageLint struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// 0 means the default of 72, a negative value turns the rule off
+	MaxSubjectLength      int   `json:"max_subject_length,omitempty"`
+	BlankLineAfterSubject *bool `json:"blank_line_after_subject,omitempty"`
+	NoTrailingPeriod      *bool `json:"no_trailing_period,omitempty"`
+}
+
+func ruleOn(rule *bool) bool {
+	return rule == nil || *rule
+}
+
+func (g *GitOperation) MessageLintEnabled() bool {
+	if g.config == nil {
+		g.LoadConfig()
+	}
+	return g.config != nil && g.config.MessageLint.Enabled
+}
+
+func (g *GitOperation) LintMessage(message string) []string {
+	rules := MessageLint{}
+	if g.config != nil {
+		rules = g.config.MessageLint
+	}
+
+	lines := strings.Split(strings.TrimRight(message, "\n"), "\n")
+	subject := lines[0]
+	problems := []string{}
+
+	maxLength := rules.MaxSubjectLength
+	if maxLength == 0 {
+		maxLength = defaultMaxSubjectLength
+	}
+	if maxLength > 0 && len([]rune(subject)) > maxLength {
+		problems = append(problems, fmt.Sprintf("subject is %d characters long, the limit is %d", len([]rune(subject)), maxLength))
+	}
+	if ruleOn(rules.NoTrailingPeriod) && strings.HasSuffix(strings.TrimSpace(subject), ".") {
+		problems = append(problems, "subject ends with a period")
+	}
+	if ruleOn(rules.BlankLineAfterSubject) && len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		problems = append(problems, "no blank line between the subject and the body")
+	}
+	return problems
+}
+
+// Unlike the lint rules, the pattern applies to every commit the tool makes
+// once it is set, unless --no-validate-message turns it off
+func (g *GitOperation) ValidateMessage(message string) error {
+	if g.config == nil {
+		g.LoadConfig()
+	}
+	if g.options.SkipMessageValidation || g.config == nil || g.config.CommitMessagePattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(g.config.CommitMessagePattern)
+	if err != nil {
+		return fmt.Errorf("invalid commit_message_pattern '%s': %v", g.config.CommitMessagePattern, err)
+	}
+
+	subject := subjectLine(message)
+	if re.MatchString(subject) {
+		return nil
+	}
+	if g.config.CommitMessageExample != "" {
+		return fmt.Errorf("commit message '%s' doesn't match commit_message_pattern %s, e.g. '%s'", subject, re.String(), g.config.CommitMessageExample)
+	}
+	return fmt.Errorf("commit message '%s' doesn't match commit_message_pattern %s", subject, re.String())
+}
+
+func subjectLine(message string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return subject
+}
+
+func (g *GitOperation) LastCommitMessage() (string, error) {
+	output, err := g.output("log", "-1", "--format=%B")
+	if err != nil {
+		return "", fmt.Errorf("failed to read the last commit: %v", err)
+	}
+	return string(output), nil
+}
@@ -0,0 +1,46 @@
+﻿package git
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLintMessage(t *testing.T) {
+	off := false
+	tests := []struct {
+		name    string
+		rules   MessageLint
+		message string
+		want    []string
+	}{
+		{"clean", MessageLint{}, "Add the thing\n\nBecause it was missing\n", []string{}},
+		{"subject only", MessageLint{}, "Add the thing", []string{}},
+		{"long subject", MessageLint{}, strings.Repeat("a", 73), []string{"subject is 73 characters long, the limit is 72"}},
+		{"long subject counts runes", MessageLint{}, strings.Repeat("é", 72), []string{}},
+		{"custom limit", MessageLint{MaxSubjectLength: 10}, "Add the thing", []string{"subject is 13 characters long, the limit is 10"}},
+		{"limit off", MessageLint{MaxSubjectLength: -1}, strings.Repeat("a", 200), []string{}},
+		{"trailing period", MessageLint{}, "Add the thing.", []string{"subject ends with a period"}},
+		{"trailing period allowed", MessageLint{NoTrailingPeriod: &off}, "Add the thing.", []string{}},
+		{"no blank line", MessageLint{}, "Add the thing\nBecause", []string{"no blank line between the subject and the body"}},
+		{"blank line not required", MessageLint{BlankLineAfterSubject: &off}, "Add the thing\nBecause", []string{}},
+		{
+			"everything",
+			MessageLint{MaxSubjectLength: 5},
+			"Add the thing.\nBecause",
+			[]string{"subject is 14 characters long, the limit is 5", "subject ends with a period", "no blank line between the subject and the body"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGitOperation(log.New(io.Discard, "", 0))
+			g.config = &Config{MessageLint: tt.rules}
+			if got := g.LintMessage(tt.message); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LintMessage(%q) = %q, want %q", tt.message, got, tt.want)
+			}
+		})
+	}
+}
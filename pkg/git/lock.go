@@ -0,0 +1,82 @@
+﻿package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrLocked = errors.New("another git-multi-push is running in this repository")
+
+// How long a lock without a readable pid is left alone, the run that
+// created it may still be writing it
+const lockGracePeriod = 10 * time.Second
+
+func (g *GitOperation) AcquireLock(wait bool) (func(), error) {
+	gitDir, err := g.GitDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(gitDir, "git-multi-push.lock")
+
+	waiting := false
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			// Called on the way out as well as deferred, only the first
+			// call may remove it, a later one could hit another run's lock
+			var once sync.Once
+			return func() { once.Do(func() { os.Remove(path) }) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file: %v", err)
+		}
+
+		pid := readLockPID(path)
+		// A run that crashed or was killed leaves its lock behind
+		if pid > 0 && !processAlive(pid) {
+			g.logger.Printf("Removing stale lock left by process %d", pid)
+			os.Remove(path)
+			continue
+		}
+		// A run that died before writing its pid leaves an empty lock
+		if pid == 0 && lockOlderThan(path, lockGracePeriod) {
+			g.logger.Printf("Removing stale lock without a process id")
+			os.Remove(path)
+			continue
+		}
+
+		if !wait {
+			return nil, fmt.Errorf("%w (pid %d), use --wait to wait for it or remove %s if it is stale", ErrLocked, pid, path)
+		}
+		if !waiting {
+			g.logger.Printf("Waiting for the run with pid %d to finish...", pid)
+			waiting = true
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func lockOlderThan(path string, age time.Duration) bool {
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) > age
+}
+
+func readLockPID(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
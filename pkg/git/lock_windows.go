@@ -0,0 +1,17 @@
+﻿//go:build windows
+
+package git
+
+import (
+	"os"
+)
+
+func processAlive(pid int) bool {
+	// On Windows FindProcess fails when there is no such process
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
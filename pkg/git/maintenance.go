@@ -0,0 +1,72 @@
+﻿package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Same default as git's gc.autoPackLimit
+const gcPackLimit = 50
+
+type RepoStats struct {
+	LooseObjects int
+	LooseKiB     int64
+	Packs        int
+	PackKiB      int64
+}
+
+func (s RepoStats) TotalKiB() int64 {
+	return s.LooseKiB + s.PackKiB
+}
+
+func (g *GitOperation) RepoStats() (RepoStats, error) {
+	output, err := g.run("count-objects", "-v")
+	if err != nil {
+		return RepoStats{}, fmt.Errorf("failed to count objects: %s", string(output))
+	}
+
+	stats := RepoStats{}
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "count":
+			stats.LooseObjects = int(n)
+		case "size":
+			stats.LooseKiB = n
+		case "packs":
+			stats.Packs = int(n)
+		case "size-pack":
+			stats.PackKiB = n
+		}
+	}
+	return stats, nil
+}
+
+func (s RepoStats) NeedsGC(thresholdMB int) bool {
+	return s.LooseKiB >= int64(thresholdMB)*1024 || s.Packs >= gcPackLimit
+}
+
+func (g *GitOperation) GC() error {
+	if g.skipForDryRun("gc", "--quiet") {
+		return nil
+	}
+	if output, err := g.run("gc", "--quiet"); err != nil {
+		return fmt.Errorf("git gc failed: %s", string(output))
+	}
+	return nil
+}
+
+func FormatKiB(kib int64) string {
+	if kib < 1024 {
+		return fmt.Sprintf("%d KiB", kib)
+	}
+	return fmt.Sprintf("%.1f MiB", float64(kib)/1024)
+}
@@ -0,0 +1,125 @@
+﻿package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const lastSuccessMetric = "gmp_push_last_success_timestamp_seconds"
+
+func WriteMetricsFile(path string, results []MirrorResult) error {
+	// Keep the last-success timestamps of earlier runs so a failing remote
+	// still reports when it was last in sync
+	lastSuccess := readLastSuccess(path)
+	failed := map[string]bool{}
+	for _, result := range results {
+		if !result.Success {
+			failed[result.RemoteName] = true
+		}
+	}
+	for _, result := range results {
+		if result.Success && !failed[result.RemoteName] {
+			lastSuccess[result.RemoteName] = float64(result.FinishedAt.UnixNano()) / 1e9
+		}
+	}
+
+	sorted := make([]MirrorResult, len(results))
+	copy(sorted, results)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Label() < sorted[j].Label()
+	})
+
+	var b strings.Builder
+	b.WriteString("# HELP gmp_push_success Whether the last push to the remote succeeded.\n")
+	b.WriteString("# TYPE gmp_push_success gauge\n")
+	for _, result := range sorted {
+		value := 0
+		if result.Success {
+			value = 1
+		}
+		fmt.Fprintf(&b, "gmp_push_success{%s} %d\n", metricLabels(result), value)
+	}
+
+	b.WriteString("# HELP gmp_push_duration_seconds Duration of the last push to the remote.\n")
+	b.WriteString("# TYPE gmp_push_duration_seconds gauge\n")
+	for _, result := range sorted {
+		fmt.Fprintf(&b, "gmp_push_duration_seconds{%s} %.3f\n", metricLabels(result), result.Duration.Seconds())
+	}
+
+	remotes := make([]string, 0, len(lastSuccess))
+	for remote := range lastSuccess {
+		remotes = append(remotes, remote)
+	}
+	sort.Strings(remotes)
+
+	fmt.Fprintf(&b, "# HELP %s Unix time of the last successful push to the remote.\n", lastSuccessMetric)
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", lastSuccessMetric)
+	for _, remote := range remotes {
+		fmt.Fprintf(&b, "%s{remote=\"%s\"} %.3f\n", lastSuccessMetric, escapeLabel(remote), lastSuccess[remote])
+	}
+
+	// Write to a temporary file and rename it so the collector never
+	// scrapes a half-written file
+	tmpPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmpPath, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write metrics: %v", err)
+	}
+	return nil
+}
+
+func readLastSuccess(path string) map[string]float64 {
+	lastSuccess := map[string]float64{}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return lastSuccess
+	}
+	defer file.Close()
+
+	prefix := lastSuccessMetric + "{remote=\""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+
+		rest := strings.TrimPrefix(line, prefix)
+		end := strings.Index(rest, "\"} ")
+		if end < 0 {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(rest[end+3:]), 64)
+		if err != nil {
+			continue
+		}
+		lastSuccess[unescapeLabel(rest[:end])] = value
+	}
+	return lastSuccess
+}
+
+func metricLabels(result MirrorResult) string {
+	labels := fmt.Sprintf("remote=\"%s\"", escapeLabel(result.RemoteName))
+	if result.Branch != "" {
+		labels += fmt.Sprintf(",branch=\"%s\"", escapeLabel(result.Branch))
+	}
+	return labels
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func unescapeLabel(value string) string {
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n").Replace(value)
+}
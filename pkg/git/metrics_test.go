@@ -0,0 +1,98 @@
+﻿package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetricsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gmp.prom")
+	first := time.Unix(1700000000, 0)
+	results := []MirrorResult{
+		{RemoteName: "gitlab", Success: true, Duration: 1500 * time.Millisecond, FinishedAt: first},
+		{RemoteName: "github", Success: true, Duration: 250 * time.Millisecond, FinishedAt: first},
+	}
+	if err := WriteMetricsFile(path, results); err != nil {
+		t.Fatal(err)
+	}
+
+	// gitlab fails the second time, its last success stays the first run
+	second := first.Add(time.Hour)
+	results = []MirrorResult{
+		{RemoteName: "github", Success: true, Duration: time.Second, FinishedAt: second},
+		{RemoteName: "gitlab", Err: errors.New("timed out"), Duration: 2 * time.Second, FinishedAt: second},
+	}
+	if err := WriteMetricsFile(path, results); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP gmp_push_success Whether the last push to the remote succeeded.
+# TYPE gmp_push_success gauge
+gmp_push_success{remote="github"} 1
+gmp_push_success{remote="gitlab"} 0
+# HELP gmp_push_duration_seconds Duration of the last push to the remote.
+# TYPE gmp_push_duration_seconds gauge
+gmp_push_duration_seconds{remote="github"} 1.000
+gmp_push_duration_seconds{remote="gitlab"} 2.000
+# HELP gmp_push_last_success_timestamp_seconds Unix time of the last successful push to the remote.
+# TYPE gmp_push_last_success_timestamp_seconds gauge
+gmp_push_last_success_timestamp_seconds{remote="github"} 1700003600.000
+gmp_push_last_success_timestamp_seconds{remote="gitlab"} 1700000000.000
+`
+	if string(data) != want {
+		t.Errorf("metrics file:\n%s\nwant:\n%s", data, want)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("the temporary file was left behind: %v", entries)
+	}
+}
+
+func TestWriteMetricsFileBranches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gmp.prom")
+	now := time.Unix(1700000000, 0)
+	// A remote with one failed branch hasn't succeeded
+	results := []MirrorResult{
+		{RemoteName: "github", Branch: "main", Success: true, FinishedAt: now},
+		{RemoteName: "github", Branch: "dev", Err: errors.New("rejected"), FinishedAt: now},
+		{RemoteName: `we"ird`, Success: true, FinishedAt: now},
+	}
+	if err := WriteMetricsFile(path, results); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := string(data)
+	for _, line := range []string{
+		`gmp_push_success{remote="github",branch="dev"} 0`,
+		`gmp_push_success{remote="github",branch="main"} 1`,
+		`gmp_push_last_success_timestamp_seconds{remote="we\"ird"} 1700000000.000`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("metrics file is missing %s:\n%s", line, metrics)
+		}
+	}
+	if strings.Contains(metrics, `gmp_push_last_success_timestamp_seconds{remote="github"}`) {
+		t.Errorf("github has a failed branch but got a last success:\n%s", metrics)
+	}
+
+	// The escaped name reads back as the same remote
+	if got := readLastSuccess(path)[`we"ird`]; got != 1700000000 {
+		t.Errorf("readLastSuccess() = %v for the escaped remote, want 1700000000", got)
+	}
+}
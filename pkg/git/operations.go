@@ -2,31 +2,156 @@
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Config struct {
-	GithubUsername string `json:"github_username"`
-	GithubRepo     string `json:"github_repo"`
-	GitlabUsername string `json:"gitlab_username"`
-	GitlabRepo     string `json:"gitlab_repo"`
+	GithubUsername    string            `json:"github_username,omitempty"`
+	GithubRepo        string            `json:"github_repo,omitempty"`
+	GitlabUsername    string            `json:"gitlab_username,omitempty"`
+	GitlabRepo        string            `json:"gitlab_repo,omitempty"`
+	PrimaryRemote     string            `json:"primary_remote,omitempty"`
+	MirrorTagTemplate string            `json:"mirror_tag_template,omitempty"`
+	Remotes           []Remote          `json:"remotes,omitempty"`
+	AutoStage         []string          `json:"auto_stage,omitempty"`
+	DefaultBranch     string            `json:"default_branch,omitempty"`
+	MessagePresets    map[string]string `json:"message_presets,omitempty"`
+	IssuePattern      string            `json:"issue_pattern,omitempty"`
+	MessageLint       MessageLint       `json:"message_lint,omitempty"`
+	BranchMessage     BranchMessage     `json:"branch_message,omitempty"`
+	ConfirmWords      []string          `json:"confirm_words,omitempty"`
+	SignCommits       bool              `json:"sign_commits,omitempty"`
+	ProtectedBranches []string          `json:"protected_branches,omitempty"`
+	PrePushCommand    string            `json:"pre_push_command,omitempty"`
+	// Refuse to run with a config file others can read, instead of warning
+	StrictConfigPermissions bool `json:"strict_config_permissions,omitempty"`
+	// How pulls bring in remote commits, merge if empty
+	SyncStrategy string `json:"sync_strategy,omitempty"`
+	// Every commit subject has to match it, the example is shown when one
+	// doesn't
+	CommitMessagePattern string `json:"commit_message_pattern,omitempty"`
+	CommitMessageExample string `json:"commit_message_example,omitempty"`
+}
+
+type PushOptions struct {
+	Force bool
+	// Like Force, but git refuses if the remote moved since it was fetched
+	ForceWithLease   bool
+	ForceNoFetch     bool
+	OnlyIfAhead      bool
+	RespectInsteadOf bool
+	CreateMissing    bool
+	TagOnPush        bool
+	PushMirrorTags   bool
+	PushTags         bool
+	TagPattern       string
+	// A single tag to push instead of all of them
+	Tag           string
+	VerifyTags    bool
+	Only          []string
+	SetRemoteHead bool
+	// Push to one remote after the other instead of all at once
+	Sequential bool
+	// Pushed instead of the checked-out branch, remotes with refspecs keep those
+	Branch string
+	// Branch name on a remote, keyed by remote name, when it differs from the
+	// local one. Pushed as local:remote
+	RemoteBranches map[string]string
+	// Remove git remotes that are no longer in the config before pushing
+	PruneRemotes bool
+	// Shell command that has to succeed before anything is pushed, replaces
+	// pre_push_command from the config
+	PrePush string
+	// Extra attempts for pushes that fail on network errors, the delay
+	// doubles after each one
+	Retries    int
+	RetryDelay time.Duration
+	// Pushed one after the other in place of Branch, each gets a result
+	// per remote
+	Branches []string
+	// Push every local branch and tag, deleting the remote ones that don't
+	// exist locally. Refspecs and tags are ignored
+	Mirror bool
+}
+
+const (
+	ResolveAbort  = "abort"
+	ResolveOurs   = "ours"
+	ResolveTheirs = "theirs"
+	ResolveManual = "manual"
+)
+
+const (
+	SyncMerge  = "merge"
+	SyncRebase = "rebase"
+	// Only pull when the local branch can be fast-forwarded, never merge
+	SyncFFOnly = "ff-only"
+)
+
+var ErrConflictsPending = errors.New("merge conflicts need to be resolved")
+
+var ErrDetachedHead = errors.New("you are in detached HEAD state; check out a branch first")
+
+var ErrMergeConflicts = errors.New("the merge has conflicts")
+
+type SyncOptions struct {
+	ResolveStrategy string
+	// Let the pull merge histories that share no commit
+	AllowUnrelated bool
+	// Fetch and pull only these configured remotes instead of all of them
+	Only []string
+	// merge, rebase or ff-only, replaces sync_strategy from the config
+	Strategy string
+	// Stash uncommitted changes before pulling and restore them afterwards
+	Autostash bool
 }
 
 type GitOperation struct {
 	logger *log.Logger
-	config *Config
+	// Where warnings go, the logger unless SetWarningLogger says otherwise
+	warnings *log.Logger
+	config   *Config
+	options  Options
+	// Repository to run git in, the working directory if empty
+	dir string
+	// Remotes fetched successfully during this run, guarded by fetchedMu
+	// since remotes are pushed to in parallel
+	fetched   map[string]bool
+	fetchedMu sync.Mutex
+	runner    Runner
+	// The config is loaded over and over, its mode is only warned about once
+	configModeOnce sync.Once
 }
 
 func NewGitOperation(logger *log.Logger) *GitOperation {
-	return &GitOperation{
-		logger: logger,
+	g := &GitOperation{
+		logger:   logger,
+		warnings: logger,
+		fetched:  map[string]bool{},
 	}
+	g.runner = execRunner{g: g}
+	return g
+}
+
+// Lets the caller filter warnings apart from the rest of the log, e.g. to
+// keep them under --quiet
+func (g *GitOperation) SetWarningLogger(logger *log.Logger) {
+	g.warnings = logger
+}
+
+func (g *GitOperation) warnf(format string, v ...interface{}) {
+	g.warnings.Output(2, "Warning: "+fmt.Sprintf(format, v...))
 }
 
 func (g *GitOperation) GetConfigDir() string {
@@ -37,29 +162,62 @@ func (g *GitOperation) GetConfigDir() string {
 	return filepath.Join(homeDir, ".config", "git-multi-push")
 }
 
+// Checked into a repository, it replaces the global config for that repository
+const localConfigFile = ".git-multi-push.json"
+
+// The repository's own config if it has one, the global one otherwise
+func (g *GitOperation) ConfigPath() string {
+	if isRepo, rootDir := g.IsGitRepo(); isRepo {
+		localPath := filepath.Join(rootDir, localConfigFile)
+		if _, err := os.Stat(localPath); err == nil {
+			return localPath
+		}
+	}
+	return filepath.Join(g.GetConfigDir(), "config.json")
+}
+
 func (g *GitOperation) LoadConfig() error {
-	configPath := filepath.Join(g.GetConfigDir(), "config.json")
-	data, err := os.ReadFile(configPath)
+	configPath := g.ConfigPath()
+	data, readErr := os.ReadFile(configPath)
+
+	// GMP_* variables override the file, or replace it entirely on CI
+	data, fromEnv, err := applyEnvOverrides(data)
 	if err != nil {
-		return fmt.Errorf("config not found, run setup first: %v", err)
+		return err
+	}
+	if readErr != nil && !fromEnv {
+		return fmt.Errorf("config not found, run setup first: %v", readErr)
 	}
 
-	g.config = &Config{}
-	if err := json.Unmarshal(data, g.config); err != nil {
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
 		return fmt.Errorf("invalid config format: %v", err)
 	}
+	if readErr == nil {
+		problem := g.configPermissionProblem(configPath)
+		if problem != "" && config.StrictConfigPermissions {
+			return fmt.Errorf("refusing to use the config (strict_config_permissions): %s", problem)
+		}
+		g.configModeOnce.Do(func() {
+			if problem != "" {
+				g.warnf("%s", problem)
+			}
+		})
+	}
+	g.config = config
+	g.config.migrateLegacyRemotes()
 	return nil
 }
 
 func (g *GitOperation) ShowStatus() error {
-	cmd := exec.Command("git", "status")
-	cmd.Stdout = os.Stdout // Direct output to console
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	// Printed straight to the console, in git's colors
+	return g.runTerminal(nil, append([]string{"status", "--"}, g.pathspecs(nil)...)...)
 }
 
 func (g *GitOperation) SaveConfig(config *Config) error {
-	configDir := g.GetConfigDir()
+	// A repository's own config is updated in place
+	configPath := g.ConfigPath()
+	configDir := filepath.Dir(configPath)
 	g.logger.Printf("Creating config directory: %s", configDir)
 
 	if err := os.MkdirAll(configDir, 0755); err != nil {
@@ -71,12 +229,15 @@ func (g *GitOperation) SaveConfig(config *Config) error {
 		return fmt.Errorf("failed to marshal config: %v", err)
 	}
 
-	configPath := filepath.Join(configDir, "config.json")
 	g.logger.Printf("Saving config to: %s", configPath)
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	if err := os.WriteFile(configPath, data, configFileMode); err != nil {
 		return fmt.Errorf("failed to write config: %v", err)
 	}
+	// WriteFile keeps the mode of a file that already exists
+	if err := os.Chmod(configPath, configFileMode); err != nil {
+		return fmt.Errorf("failed to restrict permissions of %s: %v", configPath, err)
+	}
 
 	g.config = config
 	g.logger.Printf("Configuration saved successfully to %s", configPath)
@@ -92,8 +253,7 @@ func (g *GitOperation) CheckGitInstalled() error {
 }
 
 func (g *GitOperation) IsGitRepo() (bool, string) {
-	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
-	output, err := cmd.Output()
+	output, err := g.output("rev-parse", "--show-toplevel")
 	if err != nil {
 		return false, ""
 	}
@@ -101,17 +261,97 @@ func (g *GitOperation) IsGitRepo() (bool, string) {
 }
 
 func (g *GitOperation) GetCurrentBranch() (string, error) {
-	cmd := exec.Command("git", "branch", "--show-current")
-	output, err := cmd.Output()
+	output, err := g.output("branch", "--show-current")
 	if err != nil {
 		return "", fmt.Errorf("failed to get current branch: %v", err)
 	}
 	return strings.TrimSpace(string(output)), nil
 }
 
+// Like GetCurrentBranch, but a detached HEAD is an error instead of an
+// empty name
+func (g *GitOperation) RequireBranch() (string, error) {
+	branch, err := g.GetCurrentBranch()
+	if err != nil {
+		return "", err
+	}
+	if branch == "" {
+		return "", ErrDetachedHead
+	}
+	return branch, nil
+}
+
+func (g *GitOperation) CurrentRef() (string, bool, error) {
+	branch, err := g.GetCurrentBranch()
+	if err != nil {
+		return "", false, err
+	}
+	if branch != "" {
+		return branch, false, nil
+	}
+
+	// No branch means a detached HEAD, so fall back to the commit itself
+	commit, err := g.GetHeadCommit()
+	if err != nil {
+		return "", false, err
+	}
+	return commit, true, nil
+}
+
+func (g *GitOperation) GetHeadCommit() (string, error) {
+	output, err := g.output("rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (g *GitOperation) RestoreRef(ref string, detached bool) error {
+	args := []string{"checkout", ref}
+	if detached {
+		args = []string{"checkout", "--detach", ref}
+	}
+
+	if g.skipForDryRun(args...) {
+		return nil
+	}
+	if output, err := g.run(args...); err != nil {
+		return fmt.Errorf("failed to restore %s: %s", ref, string(output))
+	}
+	return nil
+}
+
+// Checks that a branch can be created under this name, before anything
+// else happens. With force an existing one is fine, it gets reset
+func (g *GitOperation) CheckNewBranch(name string, force bool) error {
+	if _, err := g.run("check-ref-format", "--branch", name); err != nil {
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	if !force && g.requireLocalBranch(name) == nil {
+		return fmt.Errorf("branch '%s' already exists, use --force-branch to reset it to the current commit", name)
+	}
+	return nil
+}
+
+// Creates the branch at HEAD and checks it out, uncommitted changes come
+// along. force resets a branch that already exists
+func (g *GitOperation) CreateBranch(name string, force bool) error {
+	args := []string{"checkout", "-b", name}
+	if force {
+		args = []string{"checkout", "-B", name}
+	}
+	if g.skipForDryRun(args...) {
+		return nil
+	}
+
+	if output, err := g.run(args...); err != nil {
+		return fmt.Errorf("failed to create branch %s: %s", name, string(output))
+	}
+	return nil
+}
+
 func (g *GitOperation) ListBranches() ([]string, error) {
-	cmd := exec.Command("git", "branch")
-	output, err := cmd.Output()
+	output, err := g.output("branch")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list branches: %v", err)
 	}
@@ -120,7 +360,8 @@ func (g *GitOperation) ListBranches() ([]string, error) {
 	for _, branch := range strings.Split(string(output), "\n") {
 		// Remove the '* ' from current branch and any whitespace
 		branch = strings.TrimSpace(strings.TrimPrefix(branch, "*"))
-		if branch != "" {
+		// Skip the "(HEAD detached at ...)" pseudo-entry
+		if branch != "" && !strings.HasPrefix(branch, "(") {
 			branches = append(branches, branch)
 		}
 	}
@@ -128,16 +369,76 @@ func (g *GitOperation) ListBranches() ([]string, error) {
 }
 
 func (g *GitOperation) FetchAllRemotes() error {
-	cmd := exec.Command("git", "fetch", "--all")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to fetch remotes: %s", string(output))
+	output, err := g.output("remote")
+	if err != nil {
+		return fmt.Errorf("failed to list remotes: %v", err)
+	}
+	return g.fetchRemotes(strings.Fields(string(output)), true)
+}
+
+// Fetches the named remotes, with fetch --all if they are all of them
+func (g *GitOperation) fetchRemotes(remotes []string, all bool) error {
+	// A single fetch --all can't use a different SSH key per remote, the
+	// remotes that have one are fetched on their own
+	keyed, plain := []string{}, []string{}
+	for _, remote := range remotes {
+		if len(g.remoteEnv(remote)) > 0 {
+			keyed = append(keyed, remote)
+		} else {
+			plain = append(plain, remote)
+		}
+	}
+
+	multiple := len(keyed) > 0 || !all
+	args := []string{"fetch", "--all"}
+	if multiple {
+		args = []string{"fetch", "--multiple"}
+	}
+	if g.options.FetchJobs > 0 {
+		args = append(args, "--jobs", strconv.Itoa(g.options.FetchJobs))
+	}
+	if g.options.Verbose {
+		fetching := "all remotes"
+		if !all {
+			fetching = strings.Join(remotes, ", ")
+		}
+		g.logger.Printf("Fetching %s with %s", fetching, g.fetchJobsDescription())
+	}
+
+	if !multiple || len(plain) > 0 {
+		if multiple {
+			args = append(args, plain...)
+		}
+		if !g.skipForDryRun(args...) {
+			if output, err := g.runRemote("", args...); err != nil {
+				return fmt.Errorf("failed to fetch remotes: %s", string(output))
+			}
+		}
+	}
+	for _, remote := range keyed {
+		if err := g.FetchRemote(remote); err != nil {
+			return err
+		}
+	}
+
+	for _, remote := range remotes {
+		g.markFetched(remote)
 	}
 	return nil
 }
 
+func (g *GitOperation) fetchJobsDescription() string {
+	if g.options.FetchJobs > 0 {
+		return fmt.Sprintf("%d parallel job(s)", g.options.FetchJobs)
+	}
+	if output, err := g.output("config", "--get", "fetch.parallel"); err == nil {
+		return fmt.Sprintf("%s parallel job(s) (fetch.parallel)", strings.TrimSpace(string(output)))
+	}
+	return "1 job (git's default)"
+}
+
 func (g *GitOperation) ListRemoteBranches() ([]string, error) {
-	cmd := exec.Command("git", "branch", "-r")
-	output, err := cmd.CombinedOutput()
+	output, err := g.run("branch", "-r")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list remote branches: %s", string(output))
 	}
@@ -154,30 +455,291 @@ func (g *GitOperation) ListRemoteBranches() ([]string, error) {
 	return branches, nil
 }
 
-func (g *GitOperation) SyncWithRemotes() error {
-	// Fetch from all remotes
-	if err := g.FetchAllRemotes(); err != nil {
+func (g *GitOperation) FetchRemote(remote string) error {
+	if g.skipForDryRun("fetch", remote) {
+		g.markFetched(remote)
+		return nil
+	}
+	if output, err := g.runRemote(remote, "fetch", remote); err != nil {
+		return fmt.Errorf("failed to fetch %s: %s", remote, string(output))
+	}
+	g.markFetched(remote)
+	return nil
+}
+
+func (g *GitOperation) markFetched(remote string) {
+	g.fetchedMu.Lock()
+	defer g.fetchedMu.Unlock()
+	g.fetched[remote] = true
+}
+
+func (g *GitOperation) requireFetched(remote string) error {
+	g.fetchedMu.Lock()
+	fetched := g.fetched[remote]
+	g.fetchedMu.Unlock()
+	if fetched {
+		return nil
+	}
+
+	// Force pushing over history we haven't seen is how commits get lost
+	g.logger.Printf("Fetching %s before force pushing", remote)
+	if err := g.FetchRemote(remote); err != nil {
+		return fmt.Errorf("refusing to force push to %s without a successful fetch (use --force-no-fetch to override): %v", remote, err)
+	}
+	return nil
+}
+
+func (g *GitOperation) RemoteBranchExists(remote, branch string) bool {
+	_, err := g.output("rev-parse", "--verify", "--quiet", fmt.Sprintf("refs/remotes/%s/%s", remote, branch))
+	return err == nil
+}
+
+func (g *GitOperation) CheckDivergence(remote, branch string) (ahead, behind int, err error) {
+	return g.divergence(remote, branch, "HEAD")
+}
+
+func (g *GitOperation) divergence(remote, branch, local string) (ahead, behind int, err error) {
+	output, err := g.run("rev-list", "--left-right", "--count", fmt.Sprintf("%s/%s...%s", remote, branch, local))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to compare with %s/%s: %s", remote, branch, string(output))
+	}
+
+	// Left side counts commits only on the remote, right side only on local
+	counts := strings.Fields(string(output))
+	if len(counts) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %s", string(output))
+	}
+	if behind, err = strconv.Atoi(counts[0]); err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %s", string(output))
+	}
+	if ahead, err = strconv.Atoi(counts[1]); err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %s", string(output))
+	}
+	return ahead, behind, nil
+}
+
+func (g *GitOperation) ConflictedFiles() ([]string, error) {
+	output, err := g.output("diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conflicted files: %v", err)
+	}
+
+	files := []string{}
+	for _, file := range strings.Split(string(output), "\n") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (g *GitOperation) AbortMerge() error {
+	if g.skipForDryRun("merge", "--abort") {
+		return nil
+	}
+	if output, err := g.run("merge", "--abort"); err != nil {
+		return fmt.Errorf("failed to abort merge: %s", string(output))
+	}
+	return nil
+}
+
+func (g *GitOperation) syncStrategy(opts SyncOptions) (string, error) {
+	strategy := opts.Strategy
+	if strategy == "" && g.config != nil {
+		strategy = g.config.SyncStrategy
+	}
+	switch strategy {
+	case "":
+		return SyncMerge, nil
+	case SyncMerge, SyncRebase, SyncFFOnly:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown sync_strategy '%s', expected merge, rebase or ff-only", strategy)
+}
+
+// The -X option for a --resolve-strategy. A rebase replays the local commits
+// onto the remote branch, which makes that side "ours"
+func resolveOption(resolve, strategy string) string {
+	if strategy != SyncRebase {
+		return resolve
+	}
+	if resolve == ResolveOurs {
+		return ResolveTheirs
+	}
+	return ResolveOurs
+}
+
+func (g *GitOperation) SyncWithRemotes(opts SyncOptions) (err error) {
+	configured, err := g.Remotes()
+	if err != nil {
+		return err
+	}
+	if len(opts.Only) > 0 {
+		if configured, err = filterRemotes(configured, opts.Only); err != nil {
+			return err
+		}
+		fetched := []string{}
+		for _, remote := range configured {
+			if g.remoteExists(remote.Name) {
+				fetched = append(fetched, remote.Name)
+			}
+		}
+		if err := g.fetchRemotes(fetched, false); err != nil {
+			return err
+		}
+	} else if err := g.FetchAllRemotes(); err != nil {
 		return err
 	}
 
-	currentBranch, err := g.GetCurrentBranch()
+	currentBranch, err := g.RequireBranch()
 	if err != nil {
 		return err
 	}
+	strategy, err := g.syncStrategy(opts)
+	if err != nil {
+		return err
+	}
+
+	stashed := false
+	if opts.Autostash {
+		if stashed, err = g.Stash(); err != nil {
+			return err
+		}
+	}
+	// Popping in the middle of a merge or rebase would only add conflicts
+	defer func() {
+		if !stashed {
+			return
+		}
+		if errors.Is(err, ErrConflictsPending) {
+			err = fmt.Errorf("%w\n\nYour uncommitted changes were stashed before pulling, run 'git stash pop' once the conflicts are resolved", err)
+			return
+		}
+		g.logger.Printf("Restoring your stashed changes")
+		if popErr := g.StashPop(); popErr != nil {
+			err = errors.Join(err, popErr)
+		}
+	}()
 
-	// Try to pull from each remote
-	remotes := []string{"github", "gitlab"}
+	// Try to pull from each remote, or only from the primary one when the
+	// others are configured as push-only mirrors
+	remotes := []string{}
+	primaryIncluded := false
+	for _, remote := range configured {
+		remotes = append(remotes, remote.Name)
+		primaryIncluded = primaryIncluded || remote.Name == g.config.PrimaryRemote
+	}
+	switch {
+	case g.config.PrimaryRemote != "" && primaryIncluded:
+		g.logger.Printf("Pulling only from primary remote %s", g.config.PrimaryRemote)
+		remotes = []string{g.config.PrimaryRemote}
+	case g.config.PrimaryRemote != "":
+		g.logger.Printf("Not pulling, primary remote %s is not among the remotes to push to", g.config.PrimaryRemote)
+		remotes = nil
+	}
+	conflicted := []string{}
+	unrelated := []string{}
+	diverged := []string{}
 	for _, remote := range remotes {
-		pullCmd := exec.Command("git", "pull", remote, currentBranch, "--allow-unrelated-histories")
-		output, err := pullCmd.CombinedOutput()
+		// Configured remotes are only added on their first push, until then
+		// there is nothing to pull from them
+		if !g.remoteExists(remote) {
+			if g.options.Verbose {
+				g.logger.Printf("Not pulling from %s, it hasn't been pushed to yet", remote)
+			}
+			continue
+		}
+
+		// Merge explicitly, newer git refuses divergent pulls without pull.rebase set
+		pullArgs := []string{"pull", "--no-rebase", remote, currentBranch}
+		switch strategy {
+		case SyncRebase:
+			pullArgs = []string{"pull", "--rebase", remote, currentBranch}
+		case SyncFFOnly:
+			pullArgs = []string{"pull", "--ff-only", remote, currentBranch}
+		}
+		if opts.AllowUnrelated && strategy == SyncMerge {
+			pullArgs = append(pullArgs, "--allow-unrelated-histories")
+		}
+		// A fast-forward has nothing to resolve
+		if (opts.ResolveStrategy == ResolveOurs || opts.ResolveStrategy == ResolveTheirs) && strategy != SyncFFOnly {
+			pullArgs = append(pullArgs, "-X", resolveOption(opts.ResolveStrategy, strategy))
+		}
+
+		if g.skipForDryRun(pullArgs...) {
+			continue
+		}
+		output, err := g.runRemote(remote, pullArgs...)
 		g.logger.Printf("Syncing with %s: %s", remote, string(output))
-		if err != nil {
-			g.logger.Printf("Warning: Could not pull from %s: %v", remote, err)
+		if err == nil {
+			continue
+		}
+
+		if strings.Contains(string(output), "refusing to merge unrelated histories") {
+			unrelated = append(unrelated, remote)
+			continue
+		}
+		// Nothing was changed, the branches have simply diverged
+		if strategy == SyncFFOnly && strings.Contains(string(output), "Not possible to fast-forward") {
+			diverged = append(diverged, remote)
+			continue
+		}
+
+		files, _ := g.ConflictedFiles()
+		if len(files) == 0 {
+			g.warnf("Could not pull from %s: %v", remote, err)
 			// Continue with other remotes even if one fails
+			continue
 		}
+
+		if opts.ResolveStrategy == ResolveManual && strategy == SyncRebase {
+			return fmt.Errorf(`%w: rebasing onto %s stopped on conflicts in:
+  %s
+
+The repository is in the middle of a rebase. Resolve them, then either:
+1. Go on with the rebase, once for every commit that stops on conflicts,
+   and run git-multi-push again:
+   git add <files> && git-multi-push --continue
+2. Give up on this pull and get your commits back as they were:
+   git-multi-push --abort`, ErrConflictsPending, remote, strings.Join(files, "\n  "))
+		}
+		if opts.ResolveStrategy == ResolveManual {
+			return fmt.Errorf(`%w: pulling from %s left conflicts in:
+  %s
+
+Resolve them, then either:
+1. Finish the merge and run git-multi-push again:
+   git add <files> && git-multi-push --continue
+2. Give up on this pull:
+   git-multi-push --abort`, ErrConflictsPending, remote, strings.Join(files, "\n  "))
+		}
+
+		// Anything else, including conflicts -X ours/theirs can't settle,
+		// leaves the working tree as it was before the pull
+		abort := g.AbortMerge
+		if strategy == SyncRebase {
+			abort = func() error { return g.AbortOperation(OperationRebase) }
+		}
+		if err := abort(); err != nil {
+			return err
+		}
+		g.warnf("Pull from %s aborted due to conflicts in: %s", remote, strings.Join(files, ", "))
+		conflicted = append(conflicted, remote)
 	}
 
-	return nil
+	errs := []error{}
+	if len(unrelated) > 0 {
+		errs = append(errs, fmt.Errorf("git refused to merge unrelated histories from %s; if they really belong together, run again with --allow-unrelated", strings.Join(unrelated, ", ")))
+	}
+	if len(conflicted) > 0 {
+		errs = append(errs, fmt.Errorf("pull from %s aborted due to conflicts; use --resolve-strategy to resolve them", strings.Join(conflicted, ", ")))
+	}
+	if len(diverged) > 0 {
+		errs = append(errs, fmt.Errorf(`%s and your branch have diverged, so %s can't be fast-forwarded and nothing was pulled.
+Either rebase your commits onto the remote ones with --rebase, or reconcile
+them yourself, e.g. git pull --no-rebase %s %s`, strings.Join(diverged, ", "), currentBranch, diverged[0], currentBranch))
+	}
+	return errors.Join(errs...)
 }
 
 func (g *GitOperation) ValidateMerge(fromBranch, toBranch string) error {
@@ -187,9 +749,22 @@ func (g *GitOperation) ValidateMerge(fromBranch, toBranch string) error {
 	return nil
 }
 
+// The given pathspecs, or the whole tree, minus --exclude
+func (g *GitOperation) pathspecs(paths []string) []string {
+	if len(g.options.CommitExclude) == 0 {
+		return paths
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	for _, exclude := range g.options.CommitExclude {
+		paths = append(paths, ":(exclude)"+exclude)
+	}
+	return paths
+}
+
 func (g *GitOperation) HasUncommittedChanges() (bool, error) {
-	cmd := exec.Command("git", "status", "--porcelain")
-	output, err := cmd.Output()
+	output, err := g.output(append([]string{"status", "--porcelain", "--"}, g.pathspecs(nil)...)...)
 	if err != nil {
 		return false, fmt.Errorf("failed to check status: %v", err)
 	}
@@ -203,117 +778,743 @@ func (g *GitOperation) HasUncommittedChanges() (bool, error) {
 	return len(output) > 0, nil
 }
 
+func (g *GitOperation) ChangedFiles() ([]string, error) {
+	output, err := g.output(append([]string{"status", "--porcelain", "-z", "--untracked-files=all", "--"}, g.pathspecs(nil)...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check status: %v", err)
+	}
+
+	files := []string{}
+	entries := strings.Split(string(output), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		files = append(files, entry[3:])
+
+		// Renames and copies are followed by their original path
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+	}
+	return files, nil
+}
+
+func (g *GitOperation) StagedFiles() ([]string, error) {
+	// Without rename detection a staged rename shows up as both paths
+	output, err := g.output("diff", "--cached", "--name-only", "--no-renames", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staged files: %v", err)
+	}
+
+	files := []string{}
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (g *GitOperation) CommitFiles(message string, paths []string) error {
+	if err := g.ValidateMessage(message); err != nil {
+		return err
+	}
+	g.logger.Printf("Attempting to commit %d file(s) with message: %s", len(paths), subjectLine(message))
+
+	// Stage only the selected paths
+	g.logger.Printf("Staging selected files...")
+	if err := g.stage(paths); err != nil {
+		return err
+	}
+
+	// Limiting the commit to the paths leaves anything else in the index alone
+	g.logger.Printf("Committing changes...")
+	commitArgs := append(g.commitArgs(append(g.messageArgs(message), "--")...), paths...)
+	if g.skipForDryRun(commitArgs...) {
+		return nil
+	}
+	output, err := g.run(commitArgs...)
+	g.logger.Printf("Commit output: %s", string(output))
+
+	if err != nil {
+		return signingError("commit", string(output))
+	}
+
+	return nil
+}
+
+// Every path has to be in the working tree, or at least known to git so
+// deleting a tracked file can be committed
+func (g *GitOperation) ValidatePaths(paths []string) error {
+	for _, path := range paths {
+		if _, err := os.Stat(g.resolvePath(path)); err == nil {
+			continue
+		}
+		if _, err := g.run("ls-files", "--error-unmatch", "--", path); err != nil {
+			return fmt.Errorf("'%s' does not exist in the working tree", path)
+		}
+	}
+	return nil
+}
+
+func (g *GitOperation) stage(paths []string) error {
+	args := []string{"add", "."}
+	if len(paths) > 0 || len(g.options.CommitExclude) > 0 {
+		args = append([]string{"add", "--"}, g.pathspecs(paths)...)
+	}
+	if g.skipForDryRun(args...) {
+		return nil
+	}
+
+	if output, err := g.run(args...); err != nil {
+		return fmt.Errorf("failed to stage changes: %s", string(output))
+	}
+	return nil
+}
+
+func (g *GitOperation) CommitWithEditor(paths []string, message string, verbose bool) error {
+	editor, err := g.ResolveEditor()
+	if err != nil {
+		return err
+	}
+
+	g.logger.Printf("Staging changes...")
+	if err := g.stage(paths); err != nil {
+		return err
+	}
+
+	// With --verbose git appends the diff below a scissors line and always
+	// cuts the message there, whatever commit.cleanup is set to
+	args := g.commitArgs()
+	if verbose {
+		args = append(args, "--verbose")
+	}
+	if message != "" {
+		args = append(append(args, "--edit"), g.messageArgs(message)...)
+	}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+
+	if g.skipForDryRun(args...) {
+		return nil
+	}
+	g.logger.Printf("Opening %s for the commit message...", editor)
+	if err := g.runTerminal([]string{"GIT_EDITOR=" + editor}, args...); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	return nil
+}
+
+func (g *GitOperation) commitArgs(args ...string) []string {
+	commitArgs := []string{"commit"}
+	for _, trailer := range g.options.CommitTrailers {
+		commitArgs = append(commitArgs, "--trailer", trailer)
+	}
+	if g.signing() {
+		commitArgs = append(commitArgs, "-S")
+	}
+	return append(commitArgs, args...)
+}
+
+// The message as given, or the message file, which git reads itself
+func (g *GitOperation) messageArgs(message string) []string {
+	if g.options.MessageFile != "" {
+		return []string{"-F", g.options.MessageFile}
+	}
+	return []string{"-m", message}
+}
+
+func (g *GitOperation) signing() bool {
+	return g.options.Sign || (g.config != nil && g.config.SignCommits)
+}
+
+// Spells out what to check when git couldn't sign, its own message only
+// mentions gpg
+func signingError(action, output string) error {
+	lower := strings.ToLower(output)
+	if strings.Contains(lower, "failed to sign") || strings.Contains(lower, "secret key") || strings.Contains(lower, "signing failed") {
+		return fmt.Errorf(`failed to %s: %s
+Signing the commit failed. Check that a signing key is configured
+(git config user.signingkey <key id>) and that gpg can use it, e.g. with
+echo test | gpg --clearsign`, action, output)
+	}
+	return fmt.Errorf("failed to %s: %s", action, output)
+}
+
 func (g *GitOperation) Commit(message string) error {
+	if err := g.ValidateMessage(message); err != nil {
+		return err
+	}
+
 	// Debug: Log commit attempt
-	g.logger.Printf("Attempting to commit with message: %s", message)
+	g.logger.Printf("Attempting to commit with message: %s", subjectLine(message))
 
 	// Stage all changes
 	g.logger.Printf("Staging changes...")
-	addCmd := exec.Command("git", "add", ".")
-	if output, err := addCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to stage changes: %s", string(output))
+	if err := g.stage(nil); err != nil {
+		return err
 	}
 
 	// Commit changes
 	g.logger.Printf("Committing changes...")
-	commitCmd := exec.Command("git", "commit", "-m", message)
-	output, err := commitCmd.CombinedOutput()
+	if g.skipForDryRun(g.commitArgs(g.messageArgs(message)...)...) {
+		return nil
+	}
+	output, err := g.run(g.commitArgs(g.messageArgs(message)...)...)
 	g.logger.Printf("Commit output: %s", string(output))
 
 	if err != nil {
-		return fmt.Errorf("failed to commit: %s", string(output))
+		return signingError("commit", string(output))
+	}
+
+	return nil
+}
+
+// Folds the changes into the last commit, all of them unless paths are
+// given. An empty message keeps the current one
+func (g *GitOperation) AmendCommit(message string, paths []string) error {
+	if message != "" {
+		if err := g.ValidateMessage(message); err != nil {
+			return err
+		}
+	}
+	g.logger.Printf("Staging changes...")
+	if err := g.stage(paths); err != nil {
+		return err
 	}
 
+	args := g.commitArgs("--amend", "--no-edit")
+	if message != "" {
+		args = g.commitArgs(append([]string{"--amend"}, g.messageArgs(message)...)...)
+	}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	if g.skipForDryRun(args...) {
+		return nil
+	}
+	output, err := g.run(args...)
+	g.logger.Printf("Commit output: %s", string(output))
+	if err != nil {
+		return signingError("amend the last commit", string(output))
+	}
 	return nil
 }
 
+// Reports whether HEAD is already on one of the remote-tracking branches,
+// i.e. rewriting it needs a force push
+func (g *GitOperation) HeadIsPushed() (bool, error) {
+	output, err := g.run("branch", "-r", "--contains", "HEAD")
+	if err != nil {
+		return false, fmt.Errorf("failed to check the remote branches: %s", string(output))
+	}
+	return strings.TrimSpace(string(output)) != "", nil
+}
+
 func (g *GitOperation) MergeBranch(fromBranch, toBranch, message string) error {
 	// Validate the merge
 	if err := g.ValidateMerge(fromBranch, toBranch); err != nil {
 		return err
 	}
 
-	// First checkout the target branch
-	checkoutCmd := exec.Command("git", "checkout", toBranch)
-	if output, err := checkoutCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to checkout %s: %s", toBranch, string(output))
-	}
-
 	// Then merge with the specified message
 	mergeArgs := []string{"merge", fromBranch}
+	if g.signing() {
+		mergeArgs = append(mergeArgs, "-S")
+	}
 	if message != "" {
 		mergeArgs = append(mergeArgs, "-m", message)
 	}
+	if g.options.DryRun {
+		g.skipForDryRun("checkout", toBranch)
+		g.skipForDryRun(mergeArgs...)
+		return nil
+	}
 
-	mergeCmd := exec.Command("git", mergeArgs...)
-	if output, err := mergeCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to merge %s into %s: %s", fromBranch, toBranch, string(output))
+	// First checkout the target branch
+	if output, err := g.run("checkout", toBranch); err != nil {
+		return fmt.Errorf("failed to checkout %s: %s", toBranch, string(output))
+	}
+
+	if output, err := g.run(mergeArgs...); err != nil {
+		// The merge stays in progress, the caller decides whether to abort it
+		if g.HasMergeInProgress() {
+			files, _ := g.ConflictedFiles()
+			return fmt.Errorf("%w: merging %s into %s left conflicts in:\n  %s", ErrMergeConflicts, fromBranch, toBranch, strings.Join(files, "\n  "))
+		}
+		return signingError(fmt.Sprintf("merge %s into %s", fromBranch, toBranch), string(output))
 	}
 
 	return nil
 }
 
-func (g *GitOperation) Push(forcePush bool) error {
+func (g *GitOperation) Push(opts PushOptions) ([]MirrorResult, error) {
 	// First get the root directory of the git repo
 	isRepo, rootDir := g.IsGitRepo()
 	if !isRepo {
-		return fmt.Errorf("not in a git repository")
+		return nil, fmt.Errorf("not in a git repository")
 	}
 
 	// Log the repository location for clarity
 	g.logger.Printf("Operating on git repository at: %s", rootDir)
 
 	if err := g.LoadConfig(); err != nil {
+		return nil, err
+	}
+
+	if opts.PruneRemotes {
+		keep := []string{}
+		for _, remote := range g.config.Remotes {
+			keep = append(keep, remote.Name)
+		}
+		if err := g.PruneRemotes(keep); err != nil {
+			g.warnf("%v", err)
+		}
+	}
+
+	remotes, currentBranch, err := g.pushPlan(rootDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	branches := []string{currentBranch}
+	if len(opts.Branches) > 0 {
+		branches = opts.Branches
+	}
+	for _, branch := range branches {
+		if err := g.checkProtectedBranches(remotes, opts.forBranch(branch), branch); err != nil {
+			return nil, err
+		}
+	}
+	if command := g.prePushCommand(opts); command != "" {
+		if err := g.runPrePush(rootDir, command); err != nil {
+			return nil, err
+		}
+	}
+
+	defaultBranch, err := g.DefaultBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	if opts.PushTags && !opts.Mirror {
+		if tags, err = g.tagsToPush(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// A failing remote doesn't stop the others, every one gets its result
+	if opts.Sequential {
+		results := []MirrorResult{}
+		created := []Artifact{}
+		for _, remote := range remotes {
+			artifacts, err := g.prepareRemote(remote, opts)
+			created = append(created, artifacts...)
+			results = append(results, g.pushBranches(remote, opts, branches, defaultBranch, tags, err)...)
+		}
+
+		g.recordPushState(remotes, results, created)
+		return results, pushErrors(results)
+	}
+
+	// Adding remotes writes .git/config, which git locks while doing so,
+	// only the pushes themselves run in parallel
+	created := []Artifact{}
+	prepareErrs := make([]error, len(remotes))
+	for i, remote := range remotes {
+		artifacts, err := g.prepareRemote(remote, opts)
+		created = append(created, artifacts...)
+		prepareErrs[i] = err
+	}
+
+	// The logger serializes its writes and every line names its remote
+	remoteResults := make([][]MirrorResult, len(remotes))
+	var wg sync.WaitGroup
+	for i, remote := range remotes {
+		wg.Add(1)
+		go func(i int, remote Remote) {
+			defer wg.Done()
+			remoteResults[i] = g.pushBranches(remote, opts, branches, defaultBranch, tags, prepareErrs[i])
+		}(i, remote)
+	}
+	wg.Wait()
+
+	results := []MirrorResult{}
+	for _, remoteResult := range remoteResults {
+		results = append(results, remoteResult...)
+	}
+	g.recordPushState(remotes, results, created)
+	return results, pushErrors(results)
+}
+
+// Pushes each branch to the remote in turn, a failed preparation fails
+// all of them. Tags only need to go along with the first branch
+func (g *GitOperation) pushBranches(remote Remote, opts PushOptions, branches []string, defaultBranch string, tags []string, prepareErr error) []MirrorResult {
+	results := []MirrorResult{}
+	for i, branch := range branches {
+		start := time.Now()
+		branchTags := tags
+		if i > 0 {
+			branchTags = nil
+		}
+		skipped, refs, err := false, []RefOutcome(nil), prepareErr
+		if err == nil {
+			skipped, refs, err = g.pushRemote(remote, opts.forBranch(branch), branch, defaultBranch, branchTags)
+		}
+		result := newMirrorResult(remote, start, skipped, refs, err)
+		if len(opts.Branches) > 0 {
+			result.Branch = branch
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// The options for pushing one of several --branches
+func (o PushOptions) forBranch(branch string) PushOptions {
+	if len(o.Branches) > 0 {
+		o.Branch = branch
+	}
+	return o
+}
+
+func pushErrors(results []MirrorResult) error {
+	errs := []error{}
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *GitOperation) prepareRemote(remote Remote, opts PushOptions) ([]Artifact, error) {
+	created := []Artifact{}
+	path, local := localRemotePath(remote.URL)
+	if local {
+		path = g.resolvePath(path)
+		createdRepo, err := g.ensureBareRepo(path, opts.CreateMissing)
+		if createdRepo {
+			created = append(created, Artifact{Kind: ArtifactBareRepo, Name: path, Remote: remote.Name})
+		}
+		if err != nil {
+			return created, err
+		}
+	}
+
+	createdRemote, err := g.addRemote(remote.Name, remote.URL, opts.RespectInsteadOf)
+	if createdRemote {
+		created = append(created, Artifact{Kind: ArtifactRemote, Name: remote.Name, Remote: remote.Name})
+	}
+	if err != nil {
+		return created, err
+	}
+	if !local {
+		err = g.checkRemoteRepo(remote, opts.CreateMissing)
+	}
+	return created, err
+}
+
+// The remotes a push goes to and the branch it pushes, --branch or else
+// the checked-out one. A detached HEAD is only fine for remotes whose
+// refspecs name what they push
+func (g *GitOperation) pushPlan(rootDir string, opts PushOptions) ([]Remote, string, error) {
+	remotes, err := g.configuredRemotes(rootDir)
+	if err != nil {
+		return nil, "", err
+	}
+	for name := range opts.RemoteBranches {
+		if _, err := filterRemotes(remotes, []string{name}); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(opts.Only) > 0 {
+		if remotes, err = filterRemotes(remotes, opts.Only); err != nil {
+			return nil, "", err
+		}
+	}
+	// Every ref goes, so there's no branch to resolve
+	if opts.Mirror {
+		if opts.Branch != "" || len(opts.Branches) > 0 || len(opts.RemoteBranches) > 0 {
+			return nil, "", fmt.Errorf("--mirror pushes every branch, it can't be combined with other branch names")
+		}
+		return remotes, "", nil
+	}
+
+	// All of them are checked before anything is pushed
+	if len(opts.Branches) > 0 {
+		if len(opts.RemoteBranches) > 0 {
+			return nil, "", fmt.Errorf("several branches can't be pushed under other names on some remotes")
+		}
+		for _, branch := range opts.Branches {
+			if err := g.requireLocalBranch(branch); err != nil {
+				return nil, "", err
+			}
+		}
+		return remotes, "", nil
+	}
+
+	currentBranch := opts.Branch
+	if currentBranch != "" {
+		if err := g.requireLocalBranch(currentBranch); err != nil {
+			return nil, "", err
+		}
+	} else if currentBranch, err = g.GetCurrentBranch(); err != nil {
+		return nil, "", err
+	}
+	if currentBranch == "" && len(opts.RemoteBranches) > 0 {
+		return nil, "", fmt.Errorf("HEAD is detached, check out the branch to push under other names")
+	}
+	// Remotes with refspecs name what they push, the others need a branch
+	if currentBranch == "" {
+		for _, remote := range remotes {
+			if len(remote.Refspecs) == 0 {
+				return nil, "", ErrDetachedHead
+			}
+		}
+	}
+	return remotes, currentBranch, nil
+}
+
+// The branch name on the remote and the refspecs to push, none meaning
+// git's default of the checked-out branch
+func pushRefspecs(remote Remote, opts PushOptions, currentBranch string) (string, []string) {
+	remoteBranch := currentBranch
+	if target := opts.RemoteBranches[remote.Name]; target != "" {
+		remoteBranch = target
+	}
+
+	switch {
+	case len(remote.Refspecs) > 0:
+		return remoteBranch, remote.Refspecs
+	case remoteBranch != currentBranch:
+		return remoteBranch, []string{currentBranch + ":" + remoteBranch}
+	case opts.Branch != "":
+		return remoteBranch, []string{opts.Branch}
+	}
+	return remoteBranch, nil
+}
+
+// What --mirror pushes. git push --mirror would also push the
+// remote-tracking branches of every other remote
+var mirrorRefspecs = []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+
+func (o PushOptions) forceFlag() string {
+	switch {
+	case o.Mirror:
+		return "--prune"
+	case o.Force:
+		return "--force"
+	case o.ForceWithLease:
+		return "--force-with-lease"
+	}
+	return ""
+}
+
+func (g *GitOperation) pushRemote(remote Remote, opts PushOptions, currentBranch, defaultBranch string, tags []string) (bool, []RefOutcome, error) {
+	name := remote.Name
+	// The lease is checked against what was fetched, so it needs a fetch too
+	if opts.forceFlag() != "" && !opts.ForceNoFetch {
+		if err := g.requireFetched(name); err != nil {
+			return false, nil, err
+		}
+	}
+	remoteBranch, refspecs := pushRefspecs(remote, opts, currentBranch)
+	if opts.Mirror {
+		refspecs = mirrorRefspecs
+	}
+	// A detached HEAD pushed through refspecs has no branch to compare, the
+	// refspecs alone decide what goes
+	if opts.OnlyIfAhead && !opts.Mirror && currentBranch != "" {
+		skipped, err := g.isUpToDate(name, currentBranch, remoteBranch)
+		if err != nil || skipped {
+			return skipped, nil, err
+		}
+	}
+
+	if isGitDaemonURL(remote.URL) {
+		g.warnf("%s uses git://, which is read-only unless the daemon runs with --enable=receive-pack", name)
+	}
+	refs, err := g.pushWithRetries(name, opts, refspecs)
+	if err == nil && len(tags) > 0 {
+		err = g.pushTags(name, tags, opts.Force)
+	}
+	if err != nil {
+		return false, refs, err
+	}
+
+	if opts.TagOnPush && !opts.Mirror {
+		if tagErr := g.tagMirrorPush(name, currentBranch, opts.PushMirrorTags); tagErr != nil {
+			g.warnf("%v", tagErr)
+		}
+	}
+	// Querying the remote's HEAD goes over the network
+	if !g.options.DryRun {
+		g.checkRemoteHead(remote, defaultBranch, opts.SetRemoteHead)
+	}
+	return false, refs, nil
+}
+
+func newMirrorResult(remote Remote, start time.Time, skipped bool, refs []RefOutcome, err error) MirrorResult {
+	return MirrorResult{
+		RemoteName: remote.Name,
+		URL:        remote.URL,
+		Success:    err == nil,
+		Skipped:    skipped,
+		Err:        err,
+		Failure:    classifyFailure(err),
+		Refs:       refs,
+		Duration:   time.Since(start),
+		FinishedAt: time.Now(),
+	}
+}
+
+func (g *GitOperation) requireLocalBranch(branch string) error {
+	branches, err := g.ListBranches()
+	if err != nil {
 		return err
 	}
+	for _, name := range branches {
+		if name == branch {
+			return nil
+		}
+	}
+	return fmt.Errorf("branch '%s' does not exist locally (see git branch)", branch)
+}
 
-	remotes := map[string]string{
-		"github": fmt.Sprintf("git@github.com:%s/%s.git", g.config.GithubUsername, g.config.GithubRepo),
-		"gitlab": fmt.Sprintf("git@gitlab.com:%s/%s.git", g.config.GitlabUsername, g.config.GitlabRepo),
+func (g *GitOperation) isUpToDate(remote, branch, remoteBranch string) (bool, error) {
+	if err := g.FetchRemote(remote); err != nil {
+		return false, err
 	}
 
-	for name, url := range remotes {
-		if err := g.addRemote(name, url); err != nil {
-			return err
+	// A branch the remote doesn't have yet always needs pushing
+	if !g.RemoteBranchExists(remote, remoteBranch) {
+		return false, nil
+	}
+
+	ahead, _, err := g.divergence(remote, remoteBranch, "refs/heads/"+branch)
+	if err != nil {
+		return false, err
+	}
+	if ahead == 0 {
+		g.logger.Printf("Skipping %s: nothing to push, %s is not ahead of %s/%s", remote, branch, remote, remoteBranch)
+		return true, nil
+	}
+	return false, nil
+}
+
+var validRepoName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func expandTemplate(template string, values map[string]string) string {
+	for key, value := range values {
+		template = strings.ReplaceAll(template, "{"+key+"}", value)
+	}
+	return template
+}
+
+func resolveRepoName(repo, rootDir string) (string, error) {
+	if !strings.Contains(repo, "{dirname}") {
+		return repo, nil
+	}
+
+	dirName := filepath.Base(rootDir)
+	name := expandTemplate(repo, map[string]string{"dirname": dirName})
+	if !validRepoName.MatchString(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("repository name '%s' derived from directory '%s' is not a valid repository name", name, dirName)
+	}
+	return name, nil
+}
+
+func (g *GitOperation) addRemote(name, url string, respectInsteadOf bool) (bool, error) {
+	if respectInsteadOf {
+		rewritten, unchanged := g.remoteURLForInsteadOf(name, url)
+		if unchanged {
+			return false, nil
 		}
-		if err := g.pushToRemote(name, forcePush); err != nil {
-			return err
+		url = rewritten
+	}
+
+	if g.remoteExists(name) {
+		if g.skipForDryRun("remote", "set-url", name, url) {
+			return false, nil
+		}
+		if _, err := g.run("remote", "set-url", name, url); err != nil {
+			return false, fmt.Errorf("failed to update remote %s: %v", name, err)
 		}
+		return false, nil
 	}
 
-	return nil
+	if g.skipForDryRun("remote", "add", name, url) {
+		return false, nil
+	}
+	if _, err := g.run("remote", "add", name, url); err != nil {
+		return false, fmt.Errorf("failed to add remote %s: %v", name, err)
+	}
+	return true, nil
 }
 
-func (g *GitOperation) addRemote(name, url string) error {
-	checkCmd := exec.Command("git", "remote", "get-url", name)
-	if checkCmd.Run() == nil {
-		cmd := exec.Command("git", "remote", "set-url", name, url)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to update remote %s: %v", name, err)
+// Only failures to reach the remote are retried, a rejected push or bad
+// credentials won't fix themselves
+func (g *GitOperation) pushWithRetries(remote string, opts PushOptions, refspecs []string) ([]RefOutcome, error) {
+	delay := opts.RetryDelay
+	for attempt := 1; ; attempt++ {
+		refs, err := g.pushToRemote(remote, opts.forceFlag(), refspecs)
+		if err == nil || attempt > opts.Retries || classifyFailure(err) != FailureUnreachable {
+			return refs, err
 		}
-	} else {
-		cmd := exec.Command("git", "remote", "add", name, url)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to add remote %s: %v", name, err)
+		g.logger.Printf("%s: push failed, retrying in %s (%d/%d)", remote, delay, attempt, opts.Retries)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// The branch to pull for a rejected push, the remote branch it was pushed
+// to or else the default branch
+func (g *GitOperation) rejectedBranch(refs []RefOutcome) string {
+	for _, ref := range refs {
+		if ref.Status == RefRejected && strings.HasPrefix(ref.To, "refs/heads/") {
+			return shortRef(ref.To)
 		}
 	}
-	return nil
+	if branch, err := g.DefaultBranch(); err == nil && branch != "" {
+		return branch
+	}
+	return "<branch>"
 }
 
-func (g *GitOperation) pushToRemote(remote string, forcePush bool) error {
-	args := []string{"push", remote}
-	if forcePush {
-		args = append(args, "--force")
+func (g *GitOperation) pushToRemote(remote, forceFlag string, refspecs []string) ([]RefOutcome, error) {
+	args := []string{"push", "--porcelain", remote}
+	if forceFlag != "" {
+		args = append(args, forceFlag)
+	}
+	args = append(args, refspecs...)
+	if g.skipForDryRun(args...) {
+		return nil, nil
 	}
 
-	cmd := exec.Command("git", args...)
-	output, err := cmd.CombinedOutput()
-	outputStr := string(output)
+	// The porcelain lines go to stdout, hints and remote messages to stderr
+	stdout, stderr, err := g.runRemoteOutput(remote, args...)
+	refs := parsePorcelain(string(stdout))
+	if g.options.Verbose {
+		for _, ref := range refs {
+			g.logger.Printf("%s: %s", remote, ref)
+		}
+	}
+
+	outputStr := string(stderr)
+	for _, ref := range refs {
+		if ref.Status == RefRejected {
+			outputStr += fmt.Sprintf(" ! %s %s -> %s (%s)\n", ref.Summary, shortRef(ref.From), shortRef(ref.To), ref.Reason)
+		}
+	}
 
 	if err != nil {
 		// Check for protected branch error
 		if strings.Contains(outputStr, "protected branch") {
-			return fmt.Errorf(`failed to push to %s: %s
+			return refs, fmt.Errorf(`failed to push to %s: %s
 
 GitLab protected branch detected. You have several options:
 
@@ -332,21 +1533,30 @@ See README for more detailed instructions on working with protected branches.`,
 
 		// Check for fetch first error
 		if strings.Contains(outputStr, "fetch first") {
-			return fmt.Errorf(`failed to push to %s: %s
+			return refs, fmt.Errorf(`failed to push to %s: %s
 
 To resolve this, you can either:
 1. Pull and merge changes (recommended):
-   git pull %s main --allow-unrelated-histories
+   git pull %s %s
+   (git-multi-push --allow-unrelated if the histories share no commit)
 
 2. Force push (use with caution):
-   ./git-multi-push --force
+   ./git-multi-push --force-with-lease
+
+See README for more detailed instructions.`, remote, outputStr, remote, g.rejectedBranch(refs))
+		}
+
+		if strings.Contains(outputStr, "stale info") {
+			return refs, fmt.Errorf(`failed to push to %s: %s
 
-See README for more detailed instructions.`, remote, outputStr, remote)
+%s changed since it was last fetched, so --force-with-lease refused to
+overwrite it. Fetch and look at what was pushed before forcing again, or
+use --force to overwrite it anyway.`, remote, outputStr, remote)
 		}
 
-		return fmt.Errorf("failed to push to %s: %s", remote, outputStr)
+		return refs, fmt.Errorf("failed to push to %s: %s", remote, outputStr)
 	}
 
 	g.logger.Printf("Successfully pushed to %s", remote)
-	return nil
+	return refs, nil
 }
@@ -0,0 +1,198 @@
+﻿package git
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Records every command and answers the ones listed in replies, keyed by
+// their arguments. The ones in failures also exit non-zero with that
+// stderr, anything else succeeds without output
+type fakeRunner struct {
+	mu       sync.Mutex
+	commands []string
+	replies  map[string]string
+	failures map[string]string
+}
+
+func (f *fakeRunner) Run(args ...string) ([]byte, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	command := strings.Join(args, " ")
+	f.commands = append(f.commands, command)
+	if stderr, ok := f.failures[command]; ok {
+		return []byte(f.replies[command]), []byte(stderr), errors.New("exit status 1")
+	}
+	return []byte(f.replies[command]), nil, nil
+}
+
+// The commands run so far that start with prefix
+func (f *fakeRunner) ran(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	matching := []string{}
+	for _, c := range f.commands {
+		if strings.HasPrefix(c, prefix) {
+			matching = append(matching, c)
+		}
+	}
+	return matching
+}
+
+// A GitOperation on a repository at a temporary root, with config as its
+// local config and main and dev as its branches
+func newTestOperation(t *testing.T, config string, replies map[string]string) (*GitOperation, *fakeRunner) {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, localConfigFile), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &fakeRunner{replies: map[string]string{
+		"rev-parse --show-toplevel":                  root + "\n",
+		"rev-parse --absolute-git-dir":               filepath.Join(root, ".git") + "\n",
+		"branch --show-current":                      "main\n",
+		"branch":                                     "* main\n  dev\n",
+		"for-each-ref --count=1 refs/remotes/github": "abc123 commit\trefs/remotes/github/main\n",
+	}, failures: map[string]string{}}
+	for command, reply := range replies {
+		runner.replies[command] = reply
+	}
+	g := NewGitOperation(log.New(io.Discard, "", 0))
+	g.SetRunner(runner)
+	return g, runner
+}
+
+const githubConfig = `{"remotes": [{"name": "github", "url": "git@github.com:user/repo.git"}]}`
+
+func TestPushArguments(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		opts   PushOptions
+		want   []string
+	}{
+		{"current branch", githubConfig, PushOptions{}, []string{"push --porcelain github"}},
+		{"force", githubConfig, PushOptions{Force: true}, []string{"push --porcelain github --force"}},
+		{"force with lease", githubConfig, PushOptions{ForceWithLease: true}, []string{"push --porcelain github --force-with-lease"}},
+		{"force wins over the lease", githubConfig, PushOptions{Force: true, ForceWithLease: true}, []string{"push --porcelain github --force"}},
+		{
+			"refspecs",
+			`{"remotes": [{"name": "github", "url": "git@github.com:user/repo.git", "refspecs": ["HEAD:refs/heads/deploy", "+refs/tags/v*:refs/tags/v*"]}]}`,
+			PushOptions{},
+			[]string{"push --porcelain github HEAD:refs/heads/deploy +refs/tags/v*:refs/tags/v*"},
+		},
+		{"branch", githubConfig, PushOptions{Branch: "dev"}, []string{"push --porcelain github dev"}},
+		{"branches", githubConfig, PushOptions{Branches: []string{"main", "dev"}}, []string{"push --porcelain github main", "push --porcelain github dev"}},
+		{"other name on the remote", githubConfig, PushOptions{RemoteBranches: map[string]string{"github": "release"}}, []string{"push --porcelain github main:release"}},
+		{"mirror", githubConfig, PushOptions{Mirror: true}, []string{"push --porcelain github --prune +refs/heads/*:refs/heads/* +refs/tags/*:refs/tags/*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, runner := newTestOperation(t, tt.config, nil)
+			results, err := g.Push(tt.opts)
+			if err != nil {
+				t.Fatalf("Push failed: %v\ncommands:\n%s", err, strings.Join(runner.commands, "\n"))
+			}
+			for _, result := range results {
+				if !result.Success {
+					t.Errorf("push to %s failed: %v", result.Label(), result.Err)
+				}
+			}
+			if got := runner.ran("push "); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pushes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushForceFetchesFirst(t *testing.T) {
+	g, runner := newTestOperation(t, githubConfig, nil)
+	if _, err := g.Push(PushOptions{ForceWithLease: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := runner.ran("fetch "); !reflect.DeepEqual(got, []string{"fetch github"}) {
+		t.Errorf("fetches = %q, want [fetch github]", got)
+	}
+
+	g, runner = newTestOperation(t, githubConfig, nil)
+	if _, err := g.Push(PushOptions{ForceWithLease: true, ForceNoFetch: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := runner.ran("fetch "); len(got) != 0 {
+		t.Errorf("fetches = %q, want none with ForceNoFetch", got)
+	}
+}
+
+func TestPushUnknownBranch(t *testing.T) {
+	g, runner := newTestOperation(t, githubConfig, nil)
+	if _, err := g.Push(PushOptions{Branch: "missing"}); err == nil {
+		t.Fatal("Push of a branch that doesn't exist succeeded")
+	}
+	if got := runner.ran("push "); len(got) != 0 {
+		t.Errorf("pushes = %q, want none", got)
+	}
+}
+
+func TestPushRejected(t *testing.T) {
+	g, runner := newTestOperation(t, githubConfig, map[string]string{
+		"push --porcelain github": "To github.com:user/repo.git\n!\trefs/heads/main:refs/heads/main\t[rejected] (fetch first)\nDone\n",
+	})
+	runner.failures["push --porcelain github"] = "error: failed to push some refs\n"
+
+	results, err := g.Push(PushOptions{})
+	if err == nil {
+		t.Fatal("rejected push succeeded")
+	}
+	if len(results) != 1 || results[0].Failure != FailureRejected {
+		t.Fatalf("results = %+v, want one rejected", results)
+	}
+	if !strings.Contains(err.Error(), "git pull github main") {
+		t.Errorf("error doesn't suggest pulling main: %v", err)
+	}
+}
+
+func TestOnlyIfAhead(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		replies map[string]string
+		want    []string
+	}{
+		{"ahead", githubConfig, map[string]string{"rev-list --left-right --count github/main...refs/heads/main": "0\t2\n"}, []string{"push --porcelain github"}},
+		{"up to date", githubConfig, map[string]string{"rev-list --left-right --count github/main...refs/heads/main": "3\t0\n"}, []string{}},
+		{
+			"detached head with refspecs",
+			`{"remotes": [{"name": "github", "url": "git@github.com:user/repo.git", "refspecs": ["HEAD:refs/heads/deploy"]}]}`,
+			map[string]string{"branch --show-current": ""},
+			[]string{"push --porcelain github HEAD:refs/heads/deploy"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, runner := newTestOperation(t, tt.config, tt.replies)
+			results, err := g.Push(PushOptions{OnlyIfAhead: true})
+			if err != nil {
+				t.Fatalf("Push failed: %v\ncommands:\n%s", err, strings.Join(runner.commands, "\n"))
+			}
+			if got := runner.ran("push "); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pushes = %q, want %q", got, tt.want)
+			}
+			if skipped := len(tt.want) == 0; len(results) != 1 || results[0].Skipped != skipped {
+				t.Errorf("results = %+v, want skipped %v", results, skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+﻿package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+type PendingPush struct {
+	RemoteName      string
+	Branch          string
+	RemoteHasBranch bool
+	Commits         []string
+	Behind          int
+	DiffStat        string
+	Err             error
+}
+
+func (g *GitOperation) remoteExists(name string) bool {
+	_, err := g.run("remote", "get-url", name)
+	return err == nil
+}
+
+func (g *GitOperation) logOneline(revs ...string) ([]string, error) {
+	args := append([]string{"log", "--oneline"}, revs...)
+	output, err := g.run(args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits: %s", string(output))
+	}
+
+	commits := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			commits = append(commits, line)
+		}
+	}
+	return commits, nil
+}
+
+func (g *GitOperation) pendingPush(remote, branch string) PendingPush {
+	pending := PendingPush{RemoteName: remote, Branch: branch}
+	if !g.remoteExists(remote) {
+		pending.Err = fmt.Errorf("remote %s has not been added to this repository yet", remote)
+		return pending
+	}
+	if err := g.FetchRemote(remote); err != nil {
+		pending.Err = err
+		return pending
+	}
+
+	if !g.RemoteBranchExists(remote, branch) {
+		// Everything the remote doesn't have on any branch will be sent
+		pending.Commits, pending.Err = g.logOneline("HEAD", "--not", fmt.Sprintf("--remotes=%s", remote))
+		return pending
+	}
+
+	pending.RemoteHasBranch = true
+	remoteRef := fmt.Sprintf("%s/%s", remote, branch)
+	if pending.Commits, pending.Err = g.logOneline(remoteRef + "..HEAD"); pending.Err != nil {
+		return pending
+	}
+	if _, pending.Behind, pending.Err = g.CheckDivergence(remote, branch); pending.Err != nil {
+		return pending
+	}
+
+	if output, err := g.output("diff", "--shortstat", remoteRef, "HEAD"); err == nil {
+		pending.DiffStat = strings.TrimSpace(string(output))
+	}
+	return pending
+}
+
+func (g *GitOperation) PendingPushes() ([]PendingPush, error) {
+	isRepo, rootDir := g.IsGitRepo()
+	if !isRepo {
+		return nil, fmt.Errorf("not in a git repository")
+	}
+	if err := g.LoadConfig(); err != nil {
+		return nil, err
+	}
+
+	branch, err := g.GetCurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	remotes, err := g.configuredRemotes(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []PendingPush{}
+	for _, remote := range remotes {
+		pending = append(pending, g.pendingPush(remote.Name, branch))
+	}
+	return pending, nil
+}
@@ -0,0 +1,77 @@
+﻿package git
+
+import (
+	"strings"
+)
+
+const (
+	RefCreated  = "created"
+	RefUpdated  = "updated"
+	RefForced   = "forced"
+	RefDeleted  = "deleted"
+	RefRejected = "rejected"
+	RefUpToDate = "up-to-date"
+)
+
+type RefOutcome struct {
+	Status  string
+	From    string
+	To      string
+	Summary string
+	Reason  string
+}
+
+var porcelainFlags = map[byte]string{
+	' ': RefUpdated,
+	'+': RefForced,
+	'-': RefDeleted,
+	'*': RefCreated,
+	'!': RefRejected,
+	'=': RefUpToDate,
+}
+
+// Parses the "<flag>\t<from>:<to>\t<summary> (<reason>)" lines of
+// git push --porcelain, anything else (To <url>, Done, stderr) is ignored
+func parsePorcelain(output string) []RefOutcome {
+	updates := []RefOutcome{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) != 3 || len(fields[0]) != 1 {
+			continue
+		}
+		status, ok := porcelainFlags[fields[0][0]]
+		if !ok {
+			continue
+		}
+
+		from, to, _ := strings.Cut(fields[1], ":")
+		summary, reason := fields[2], ""
+		if i := strings.Index(summary, " ("); i >= 0 && strings.HasSuffix(summary, ")") {
+			summary, reason = summary[:i], summary[i+2:len(summary)-1]
+		}
+		updates = append(updates, RefOutcome{Status: status, From: from, To: to, Summary: summary, Reason: reason})
+	}
+	return updates
+}
+
+func (u RefOutcome) String() string {
+	text := shortRef(u.From) + " -> " + shortRef(u.To) + " " + u.Status
+	if u.Status == RefDeleted {
+		text = shortRef(u.To) + " " + u.Status
+	}
+	if u.Reason != "" {
+		text += " (" + u.Reason + ")"
+	} else if u.Status == RefUpdated || u.Status == RefForced {
+		text += " (" + u.Summary + ")"
+	}
+	return text
+}
+
+func shortRef(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return strings.TrimPrefix(ref, prefix)
+		}
+	}
+	return ref
+}
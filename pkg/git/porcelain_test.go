@@ -0,0 +1,72 @@
+﻿package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePorcelain(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []RefOutcome
+	}{
+		{"nothing", "", []RefOutcome{}},
+		{
+			"updated",
+			"To github.com:user/repo.git\n \trefs/heads/main:refs/heads/main\tabc123..def456\nDone\n",
+			[]RefOutcome{{Status: RefUpdated, From: "refs/heads/main", To: "refs/heads/main", Summary: "abc123..def456"}},
+		},
+		{
+			"forced",
+			"+\trefs/heads/main:refs/heads/main\tabc123...def456 (forced update)\n",
+			[]RefOutcome{{Status: RefForced, From: "refs/heads/main", To: "refs/heads/main", Summary: "abc123...def456", Reason: "forced update"}},
+		},
+		{
+			"created and up to date",
+			"*\trefs/heads/dev:refs/heads/dev\t[new branch]\n=\trefs/tags/v1:refs/tags/v1\t[up to date]\n",
+			[]RefOutcome{
+				{Status: RefCreated, From: "refs/heads/dev", To: "refs/heads/dev", Summary: "[new branch]"},
+				{Status: RefUpToDate, From: "refs/tags/v1", To: "refs/tags/v1", Summary: "[up to date]"},
+			},
+		},
+		{
+			"deleted",
+			"-\t:refs/heads/old\t[deleted]\n",
+			[]RefOutcome{{Status: RefDeleted, From: "", To: "refs/heads/old", Summary: "[deleted]"}},
+		},
+		{
+			"rejected with CRLF",
+			"!\trefs/heads/main:refs/heads/main\t[rejected] (fetch first)\r\n",
+			[]RefOutcome{{Status: RefRejected, From: "refs/heads/main", To: "refs/heads/main", Summary: "[rejected]", Reason: "fetch first"}},
+		},
+		{"unknown flag", "?\trefs/heads/main:refs/heads/main\t[odd]\n", []RefOutcome{}},
+		{"stderr noise", "hint: Updates were rejected\nerror: failed to push some refs\n", []RefOutcome{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePorcelain(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePorcelain() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefOutcomeString(t *testing.T) {
+	tests := []struct {
+		ref  RefOutcome
+		want string
+	}{
+		{RefOutcome{Status: RefUpdated, From: "refs/heads/main", To: "refs/heads/main", Summary: "abc..def"}, "main -> main updated (abc..def)"},
+		{RefOutcome{Status: RefRejected, From: "refs/heads/main", To: "refs/heads/main", Summary: "[rejected]", Reason: "fetch first"}, "main -> main rejected (fetch first)"},
+		{RefOutcome{Status: RefDeleted, To: "refs/tags/v1", Summary: "[deleted]"}, "v1 deleted"},
+		{RefOutcome{Status: RefCreated, From: "HEAD", To: "refs/heads/deploy", Summary: "[new branch]"}, "HEAD -> deploy created"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.ref.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+﻿package git
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime"
+)
+
+// Logs whatever is written to it line by line
+type logWriter struct {
+	logger  *log.Logger
+	prefix  string
+	pending []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.logger.Printf("%s%s", w.prefix, bytes.TrimRight(w.pending[:i], "\r"))
+		w.pending = w.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *logWriter) flush() {
+	if len(w.pending) > 0 {
+		w.logger.Printf("%s%s", w.prefix, w.pending)
+		w.pending = nil
+	}
+}
+
+func (g *GitOperation) prePushCommand(opts PushOptions) string {
+	if opts.PrePush != "" {
+		return opts.PrePush
+	}
+	if g.config != nil {
+		return g.config.PrePushCommand
+	}
+	return ""
+}
+
+// Runs the pre-push command through the shell from the repository root,
+// a failing command stops the push before any remote is contacted
+func (g *GitOperation) runPrePush(rootDir, command string) error {
+	if g.options.DryRun {
+		g.logger.Printf("[dry-run] pre-push: %s", command)
+		return nil
+	}
+
+	g.logger.Printf("Running pre-push command: %s", command)
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	cmd.Dir = rootDir
+	output := &logWriter{logger: g.logger, prefix: "[pre-push] "}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err := cmd.Run()
+	output.flush()
+	if err != nil {
+		return fmt.Errorf("pre-push command failed (%v), nothing was pushed", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+﻿package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+func (g *GitOperation) MessagePresets() map[string]string {
+	if g.config == nil {
+		if err := g.LoadConfig(); err != nil {
+			return nil
+		}
+	}
+	return g.config.MessagePresets
+}
+
+func PresetNames(presets map[string]string) []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (g *GitOperation) PresetMessage(name string) (string, error) {
+	template, ok := g.MessagePresets()[name]
+	if !ok {
+		return "", fmt.Errorf("unknown message preset '%s'", name)
+	}
+
+	branch, _ := g.GetCurrentBranch()
+	_, rootDir := g.IsGitRepo()
+	message := expandTemplate(template, map[string]string{
+		"branch":  branch,
+		"date":    time.Now().Format("2006-01-02"),
+		"dirname": filepath.Base(rootDir),
+	})
+	if message == "" {
+		return "", fmt.Errorf("message preset '%s' is empty", name)
+	}
+	return message, nil
+}
@@ -0,0 +1,76 @@
+﻿package git
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+func (g *GitOperation) isProtectedBranch(branch string) bool {
+	if g.config == nil || branch == "" {
+		return false
+	}
+	for _, pattern := range g.config.ProtectedBranches {
+		if matched, _ := path.Match(pattern, branch); matched || pattern == branch {
+			return true
+		}
+	}
+	return false
+}
+
+// The branch a refspec updates on the remote, empty if it isn't a branch
+func refspecBranch(refspec string) string {
+	refspec = strings.TrimPrefix(refspec, "+")
+	if _, dst, ok := strings.Cut(refspec, ":"); ok {
+		refspec = dst
+	}
+	if strings.HasPrefix(refspec, "refs/") && !strings.HasPrefix(refspec, "refs/heads/") {
+		return ""
+	}
+	return strings.TrimPrefix(refspec, "refs/heads/")
+}
+
+// Refuses to push to a branch listed in protected_branches before any
+// remote is contacted, unless --force was given and confirmed. A lease or
+// --mirror doesn't count, they still overwrite or delete the branch
+func (g *GitOperation) checkProtectedBranches(remotes []Remote, opts PushOptions, currentBranch string) error {
+	if opts.Force {
+		return nil
+	}
+	// Every branch is pushed and the ones missing locally are deleted
+	if opts.Mirror && g.config != nil && len(g.config.ProtectedBranches) > 0 {
+		return fmt.Errorf("refusing to mirror, it rewrites or deletes the protected branches %s, use --force to push anyway", strings.Join(g.config.ProtectedBranches, ", "))
+	}
+
+	byBranch := map[string][]string{}
+	for _, remote := range remotes {
+		remoteBranch, refspecs := pushRefspecs(remote, opts, currentBranch)
+		branches := []string{remoteBranch}
+		if len(remote.Refspecs) > 0 {
+			branches = nil
+			for _, refspec := range refspecs {
+				branches = append(branches, refspecBranch(refspec))
+			}
+		}
+		for _, branch := range branches {
+			if g.isProtectedBranch(branch) {
+				byBranch[branch] = append(byBranch[branch], remote.Name)
+			}
+		}
+	}
+	if len(byBranch) == 0 {
+		return nil
+	}
+
+	branches := make([]string, 0, len(byBranch))
+	for branch := range byBranch {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	messages := []string{}
+	for _, branch := range branches {
+		messages = append(messages, fmt.Sprintf("'%s' (%s)", branch, strings.Join(byBranch[branch], ", ")))
+	}
+	return fmt.Errorf("refusing to push to protected branch %s, use --force to push anyway", strings.Join(messages, " and "))
+}
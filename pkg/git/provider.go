@@ -0,0 +1,207 @@
+﻿package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API returned %s: %s", e.Provider, e.Status, e.Body)
+}
+
+func remoteProvider(remote Remote) (string, *RemoteURL, error) {
+	parsed, err := ParseRemoteURL(remote.URL)
+	if err != nil {
+		return "", nil, err
+	}
+	if remote.Provider != "" {
+		return remote.Provider, parsed, nil
+	}
+	return parsed.Provider(), parsed, nil
+}
+
+func repoPath(parsed *RemoteURL) string {
+	return strings.TrimSuffix(parsed.Path, ".git")
+}
+
+// The page showing a commit on the remote's web interface, empty for remotes
+// that don't have one
+func CommitWebURL(remote Remote, sha string) string {
+	provider, parsed, err := remoteProvider(remote)
+	if err != nil {
+		return ""
+	}
+	// The web interface is served over https even when pushing over ssh
+	base := "https://" + parsed.Host
+	if parsed.Scheme == "http" || parsed.Scheme == "https" {
+		base = parsed.Scheme + "://" + parsed.Host
+		if parsed.Port != "" {
+			base += ":" + parsed.Port
+		}
+	}
+	repo := repoPath(parsed)
+
+	switch provider {
+	case ProviderGithub:
+		return fmt.Sprintf("%s/%s/commit/%s", base, repo, sha)
+	case ProviderGitlab:
+		return fmt.Sprintf("%s/%s/-/commit/%s", base, repo, sha)
+	case ProviderBitbucket:
+		return fmt.Sprintf("%s/%s/commits/%s", base, repo, sha)
+	}
+	return ""
+}
+
+func githubAPIBase(host string) string {
+	if host == "github.com" {
+		return "https://api.github.com"
+	}
+	// GitHub Enterprise serves the API below the web host
+	return "https://" + host + "/api/v3"
+}
+
+func gitlabAPIBase(host string) string {
+	return "https://" + host + "/api/v4"
+}
+
+func providerToken(provider string) (string, error) {
+	name := strings.ToUpper(provider) + "_TOKEN"
+	token := os.Getenv(name)
+	if token == "" {
+		return "", fmt.Errorf("%s is not set, it is needed to talk to the %s API", name, provider)
+	}
+	return token, nil
+}
+
+func providerRequest(provider, method, endpoint string, body interface{}, result interface{}) error {
+	token, err := providerToken(provider)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("invalid API request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch provider {
+	case ProviderGithub:
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	case ProviderGitlab:
+		req.Header.Set("PRIVATE-TOKEN", token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s API request failed: %v", provider, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 300 {
+		return &APIError{Provider: provider, StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(data))}
+	}
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("unexpected %s API response: %v", provider, err)
+		}
+	}
+	return nil
+}
+
+// Creates the remote's repository through the hosting service's API, as a
+// private repository owned by the user or group in the remote's URL
+func CreateRemoteRepo(remote Remote) error {
+	provider, parsed, err := remoteProvider(remote)
+	if err != nil {
+		return err
+	}
+	repo := repoPath(parsed)
+	slash := strings.LastIndex(repo, "/")
+	if slash < 0 {
+		return fmt.Errorf("can't tell who owns %s from its URL %s", remote.Name, remote.URL)
+	}
+	owner, name := repo[:slash], repo[slash+1:]
+
+	switch provider {
+	case ProviderGithub:
+		base := githubAPIBase(parsed.Host)
+		var user struct {
+			Login string `json:"login"`
+		}
+		if err := providerRequest(provider, http.MethodGet, base+"/user", nil, &user); err != nil {
+			return err
+		}
+		// Repositories of the token's own account and of organizations are
+		// created through different endpoints
+		endpoint := base + "/user/repos"
+		if !strings.EqualFold(user.Login, owner) {
+			endpoint = fmt.Sprintf("%s/orgs/%s/repos", base, owner)
+		}
+		return providerRequest(provider, http.MethodPost, endpoint, map[string]interface{}{"name": name, "private": true}, nil)
+	case ProviderGitlab:
+		base := gitlabAPIBase(parsed.Host)
+		var namespace struct {
+			ID int `json:"id"`
+		}
+		if err := providerRequest(provider, http.MethodGet, fmt.Sprintf("%s/namespaces/%s", base, url.PathEscape(owner)), nil, &namespace); err != nil {
+			return err
+		}
+		body := map[string]interface{}{"name": name, "path": name, "namespace_id": namespace.ID, "visibility": "private"}
+		return providerRequest(provider, http.MethodPost, base+"/projects", body, nil)
+	default:
+		return fmt.Errorf("can't create repositories on %s automatically, create it in the hosting service first", remote.Name)
+	}
+}
+
+func (g *GitOperation) SetRemoteHead(remote Remote, branch string) error {
+	provider, parsed, err := remoteProvider(remote)
+	if err != nil {
+		return err
+	}
+
+	switch provider {
+	case ProviderLocal:
+		if g.skipForDryRun("--git-dir", parsed.Path, "symbolic-ref", "HEAD", "refs/heads/"+branch) {
+			return nil
+		}
+		if output, err := g.run("--git-dir", parsed.Path, "symbolic-ref", "HEAD", "refs/heads/"+branch); err != nil {
+			return fmt.Errorf("failed to set HEAD of %s: %s", parsed.Path, string(output))
+		}
+	case ProviderGithub:
+		endpoint := fmt.Sprintf("%s/repos/%s", githubAPIBase(parsed.Host), repoPath(parsed))
+		return providerRequest(provider, http.MethodPatch, endpoint, map[string]string{"default_branch": branch}, nil)
+	case ProviderGitlab:
+		endpoint := fmt.Sprintf("%s/projects/%s", gitlabAPIBase(parsed.Host), url.PathEscape(repoPath(parsed)))
+		return providerRequest(provider, http.MethodPut, endpoint, map[string]string{"default_branch": branch}, nil)
+	default:
+		return fmt.Errorf("can't change the default branch of %s automatically, change it in the hosting service's settings", remote.Name)
+	}
+	return nil
+}
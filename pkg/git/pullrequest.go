@@ -0,0 +1,86 @@
+﻿package git
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func (g *GitOperation) lastCommitSubject() (string, error) {
+	output, err := g.output("log", "-1", "--format=%s")
+	if err != nil {
+		return "", fmt.Errorf("failed to read the last commit: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (g *GitOperation) OpenPullRequest(remote Remote, branch, base string) (string, bool, error) {
+	provider, parsed, err := remoteProvider(remote)
+	if err != nil {
+		return "", false, err
+	}
+	title, err := g.lastCommitSubject()
+	if err != nil {
+		return "", false, err
+	}
+	repo := repoPath(parsed)
+
+	switch provider {
+	case ProviderGithub:
+		endpoint := fmt.Sprintf("%s/repos/%s/pulls", githubAPIBase(parsed.Host), repo)
+		var created struct {
+			HTMLURL string `json:"html_url"`
+		}
+		err := providerRequest(provider, http.MethodPost, endpoint, map[string]string{"title": title, "head": branch, "base": base}, &created)
+		if err == nil {
+			return created.HTMLURL, false, nil
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(apiErr.Body, "already exists") {
+			return "", false, err
+		}
+		owner, _, _ := strings.Cut(repo, "/")
+		query := url.Values{"head": {owner + ":" + branch}, "base": {base}, "state": {"open"}}
+		var existing []struct {
+			HTMLURL string `json:"html_url"`
+		}
+		if err := providerRequest(provider, http.MethodGet, endpoint+"?"+query.Encode(), nil, &existing); err != nil {
+			return "", false, err
+		}
+		if len(existing) == 0 {
+			return "", false, fmt.Errorf("GitHub reports an existing pull request for %s but it could not be found", branch)
+		}
+		return existing[0].HTMLURL, true, nil
+
+	case ProviderGitlab:
+		endpoint := fmt.Sprintf("%s/projects/%s/merge_requests", gitlabAPIBase(parsed.Host), url.PathEscape(repo))
+		var created struct {
+			WebURL string `json:"web_url"`
+		}
+		err := providerRequest(provider, http.MethodPost, endpoint, map[string]string{"title": title, "source_branch": branch, "target_branch": base}, &created)
+		if err == nil {
+			return created.WebURL, false, nil
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+			return "", false, err
+		}
+		query := url.Values{"source_branch": {branch}, "target_branch": {base}, "state": {"opened"}}
+		var existing []struct {
+			WebURL string `json:"web_url"`
+		}
+		if err := providerRequest(provider, http.MethodGet, endpoint+"?"+query.Encode(), nil, &existing); err != nil {
+			return "", false, err
+		}
+		if len(existing) == 0 {
+			return "", false, fmt.Errorf("GitLab reports an existing merge request for %s but it could not be found", branch)
+		}
+		return existing[0].WebURL, true, nil
+	}
+
+	return "", false, fmt.Errorf("skipped, pull requests can only be opened on GitHub and GitLab (%s is %s)", remote.Name, provider)
+}
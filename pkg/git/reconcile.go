@@ -0,0 +1,140 @@
+﻿package git
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type RefUpdate struct {
+	Ref         string
+	SHA         string
+	OldSHA      string
+	FastForward bool
+}
+
+type ReconcilePlan struct {
+	From     string
+	To       string
+	Missing  []RefUpdate
+	Diverged []RefUpdate
+}
+
+func (g *GitOperation) listRemoteRefs(remote string) (map[string]string, error) {
+	output, _, err := g.runRemoteOutput(remote, "ls-remote", "--heads", "--tags", remote)
+	if errors.Is(err, ErrTimeout) {
+		return nil, fmt.Errorf("failed to list refs on %s: %w", remote, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs on %s: %v", remote, err)
+	}
+
+	refs := map[string]string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		// Skip the peeled entries of annotated tags
+		if len(fields) != 2 || strings.HasSuffix(fields[1], "^{}") {
+			continue
+		}
+		refs[fields[1]] = fields[0]
+	}
+	return refs, nil
+}
+
+func (g *GitOperation) PlanReconcile(from, to string) (*ReconcilePlan, error) {
+	if from == to {
+		return nil, fmt.Errorf("cannot reconcile a remote with itself")
+	}
+
+	fromRefs, err := g.listRemoteRefs(from)
+	if err != nil {
+		return nil, err
+	}
+	toRefs, err := g.listRemoteRefs(to)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ReconcilePlan{From: from, To: to}
+	wanted := []string{}
+	for ref, sha := range fromRefs {
+		oldSHA, ok := toRefs[ref]
+		if ok && oldSHA == sha {
+			continue
+		}
+
+		update := RefUpdate{Ref: ref, SHA: sha, OldSHA: oldSHA}
+		if ok {
+			plan.Diverged = append(plan.Diverged, update)
+		} else {
+			plan.Missing = append(plan.Missing, update)
+		}
+		wanted = append(wanted, sha)
+	}
+	sort.Slice(plan.Missing, func(i, j int) bool { return plan.Missing[i].Ref < plan.Missing[j].Ref })
+	sort.Slice(plan.Diverged, func(i, j int) bool { return plan.Diverged[i].Ref < plan.Diverged[j].Ref })
+
+	if len(wanted) == 0 {
+		return plan, nil
+	}
+
+	// Bring in the lagging remote's history so fast-forwards can be told
+	// apart from rewrites, then the objects the canonical remote has
+	if err := g.FetchRemote(to); err != nil {
+		return nil, err
+	}
+	// Without the fetch only what is already known locally tells a
+	// fast-forward apart
+	fetchArgs := append([]string{"fetch", "--no-tags", from}, wanted...)
+	if !g.skipForDryRun(fetchArgs...) {
+		if output, err := g.runRemote(from, fetchArgs...); err != nil {
+			return nil, fmt.Errorf("failed to fetch from %s: %s", from, string(output))
+		}
+	}
+
+	// git never moves an existing tag without force, even forward
+	for i, update := range plan.Diverged {
+		if strings.HasPrefix(update.Ref, "refs/tags/") {
+			continue
+		}
+		_, err := g.output("merge-base", "--is-ancestor", update.OldSHA, update.SHA)
+		plan.Diverged[i].FastForward = err == nil
+	}
+	return plan, nil
+}
+
+func (g *GitOperation) Reconcile(plan *ReconcilePlan, allowForce bool) error {
+	refspecs := []string{}
+	for _, update := range plan.Missing {
+		refspecs = append(refspecs, fmt.Sprintf("%s:%s", update.SHA, update.Ref))
+	}
+	for _, update := range plan.Diverged {
+		switch {
+		case update.FastForward:
+			refspecs = append(refspecs, fmt.Sprintf("%s:%s", update.SHA, update.Ref))
+		case allowForce:
+			refspecs = append(refspecs, fmt.Sprintf("+%s:%s", update.SHA, update.Ref))
+		default:
+			g.logger.Printf("Leaving %s on %s unchanged: it has diverged from %s", update.Ref, plan.To, plan.From)
+		}
+	}
+
+	if len(refspecs) == 0 {
+		g.logger.Printf("Nothing to push to %s", plan.To)
+		return nil
+	}
+
+	args := append([]string{"push", plan.To}, refspecs...)
+	if g.skipForDryRun(args...) {
+		return nil
+	}
+	output, err := g.runRemote(plan.To, args...)
+	g.logger.Printf("Reconcile output: %s", string(output))
+	if err != nil {
+		return fmt.Errorf("failed to push to %s: %s", plan.To, string(output))
+	}
+
+	g.logger.Printf("Successfully reconciled %s with %s", plan.To, plan.From)
+	return nil
+}
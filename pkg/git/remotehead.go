@@ -0,0 +1,67 @@
+﻿package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (g *GitOperation) DefaultBranch() (string, error) {
+	if g.config != nil && g.config.DefaultBranch != "" {
+		return g.config.DefaultBranch, nil
+	}
+	for _, branch := range []string{"main", "master"} {
+		if _, err := g.output("rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			return branch, nil
+		}
+	}
+	return g.GetCurrentBranch()
+}
+
+func (g *GitOperation) remoteHeadBranch(remote Remote) (string, error) {
+	// ls-remote hides a HEAD that points at a branch which doesn't exist yet,
+	// local repositories can be asked directly
+	if path, ok := localRemotePath(remote.URL); ok {
+		output, err := g.run("--git-dir", path, "symbolic-ref", "HEAD")
+		if err != nil {
+			return "", fmt.Errorf("failed to read HEAD of %s: %s", path, strings.TrimSpace(string(output)))
+		}
+		return strings.TrimPrefix(strings.TrimSpace(string(output)), "refs/heads/"), nil
+	}
+
+	branch, _, err := g.GetRemoteHead(remote)
+	return branch, err
+}
+
+func (g *GitOperation) checkRemoteHead(remote Remote, defaultBranch string, fix bool) {
+	head, err := g.remoteHeadBranch(remote)
+	if err != nil {
+		g.warnf("%v", err)
+		return
+	}
+	// Empty repositories and some servers don't report a symbolic HEAD
+	if head == "" || head == defaultBranch {
+		return
+	}
+
+	if !fix {
+		g.warnf("HEAD of %s points at '%s' but your default branch is '%s', clones of it will check out the wrong branch (use --set-remote-head to fix)", remote.Name, head, defaultBranch)
+		return
+	}
+
+	if err := g.SetRemoteHead(remote, defaultBranch); err != nil {
+		g.warnf("failed to point HEAD of %s at '%s': %v", remote.Name, defaultBranch, err)
+		return
+	}
+	g.logger.Printf("Pointed HEAD of %s at '%s' (was '%s')", remote.Name, defaultBranch, head)
+}
+
+func (g *GitOperation) Remotes() ([]Remote, error) {
+	isRepo, rootDir := g.IsGitRepo()
+	if !isRepo {
+		return nil, fmt.Errorf("not in a git repository")
+	}
+	if err := g.LoadConfig(); err != nil {
+		return nil, err
+	}
+	return g.configuredRemotes(rootDir)
+}
@@ -0,0 +1,55 @@
+﻿package git
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Where a repository that doesn't exist yet can be created, empty for
+// hosts without a known page for it
+func newRepoURL(remote Remote) string {
+	provider, parsed, err := remoteProvider(remote)
+	if err != nil {
+		return ""
+	}
+	switch provider {
+	case ProviderGithub:
+		return "https://" + parsed.Host + "/new"
+	case ProviderGitlab:
+		return "https://" + parsed.Host + "/projects/new"
+	case ProviderBitbucket:
+		return "https://" + parsed.Host + "/repo/create"
+	}
+	return ""
+}
+
+// A remote that was never fetched from or pushed to is asked whether its
+// repository exists, so a missing one is created with createMissing or
+// reported with what to do about it. Other problems are left for the push
+// to report
+func (g *GitOperation) checkRemoteRepo(remote Remote, createMissing bool) error {
+	if g.options.DryRun || g.hasRemoteRefs(remote.Name) {
+		return nil
+	}
+	output, err := g.runRemote(remote.Name, "ls-remote", "--heads", remote.Name)
+	if err == nil || classifyFailure(fmt.Errorf("%s", output)) != FailureNotFound {
+		return nil
+	}
+
+	if createMissing {
+		g.logger.Printf("Creating repository for %s (%s)", remote.Name, remote.URL)
+		if err := CreateRemoteRepo(remote); err != nil {
+			return fmt.Errorf("repository not found for %s and creating it failed: %v", remote.Name, err)
+		}
+		return nil
+	}
+	if url := newRepoURL(remote); url != "" {
+		return fmt.Errorf("repository not found for %s (%s), create it first at %s or run with --create-missing", remote.Name, remote.URL, url)
+	}
+	return fmt.Errorf("repository not found for %s (%s), create it on the server first and push again", remote.Name, remote.URL)
+}
+
+func (g *GitOperation) hasRemoteRefs(remote string) bool {
+	output, err := g.run("for-each-ref", "--count=1", "refs/remotes/"+remote)
+	return err == nil && len(bytes.TrimSpace(output)) > 0
+}
@@ -0,0 +1,329 @@
+﻿package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Remote struct {
+	Name     string `json:"name"`
+	URL      string `json:"url,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	// SSH port for hosts that don't listen on 22
+	Port        int    `json:"port,omitempty"`
+	URLTemplate string `json:"url_template,omitempty"`
+	// Pushed instead of the current branch when set
+	Refspecs []string `json:"refspecs,omitempty"`
+	// Build the URL from its parts when neither url nor url_template is set
+	Host     string `json:"host,omitempty"`
+	Username string `json:"username,omitempty"`
+	Repo     string `json:"repo,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	// Put before username/repo for servers that serve repositories below
+	// a path, e.g. "git" for host/git/username/repo.git
+	PathPrefix string `json:"path_prefix,omitempty"`
+	// Private key to use for this remote instead of the ssh default
+	SSHKeyPath string `json:"ssh_key_path,omitempty"`
+}
+
+var windowsDrivePath = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+
+// Configs written before remotes could be listed only had the four
+// github/gitlab fields, those become the first entries of the list
+func (c *Config) migrateLegacyRemotes() {
+	legacy := []Remote{}
+	if c.GithubUsername != "" {
+		legacy = append(legacy, Remote{Name: "github", Host: "github.com", Username: c.GithubUsername, Repo: c.GithubRepo})
+	}
+	if c.GitlabUsername != "" {
+		legacy = append(legacy, Remote{Name: "gitlab", Host: "gitlab.com", Username: c.GitlabUsername, Repo: c.GitlabRepo})
+	}
+
+	// An entry in the list with the same name wins
+	migrated := []Remote{}
+	for _, remote := range legacy {
+		if _, err := filterRemotes(c.Remotes, []string{remote.Name}); err != nil {
+			migrated = append(migrated, remote)
+		}
+	}
+	c.Remotes = append(migrated, c.Remotes...)
+	c.GithubUsername, c.GithubRepo, c.GitlabUsername, c.GitlabRepo = "", "", "", ""
+}
+
+func (g *GitOperation) configuredRemotes(rootDir string) ([]Remote, error) {
+	remotes := []Remote{}
+	for _, remote := range g.config.Remotes {
+		url, err := remote.resolveURL(rootDir)
+		if err != nil {
+			return nil, err
+		}
+		remote.URL = url
+		if parsed, err := ParseRemoteURL(url); err == nil && parsed.Scheme == "git" && parsed.User != "" {
+			return nil, fmt.Errorf("remote %s: git:// has no authentication, remove '%s@' from the url", remote.Name, parsed.User)
+		}
+		if remote.SSHKeyPath != "" {
+			if _, err := os.Stat(expandHome(remote.SSHKeyPath)); err != nil {
+				return nil, fmt.Errorf("remote %s: ssh key %s: %v", remote.Name, remote.SSHKeyPath, err)
+			}
+		}
+		for _, refspec := range remote.Refspecs {
+			if err := validateRefspec(refspec); err != nil {
+				return nil, fmt.Errorf("remote %s: invalid refspec '%s': %v", remote.Name, refspec, err)
+			}
+		}
+		remotes = append(remotes, remote)
+	}
+	return remotes, nil
+}
+
+func validateRefspec(refspec string) error {
+	spec := strings.TrimPrefix(refspec, "+")
+	if spec == "" {
+		return fmt.Errorf("refspec is empty")
+	}
+	if strings.ContainsAny(spec, " \t\n") {
+		return fmt.Errorf("refspec contains whitespace")
+	}
+
+	src, dst, hasDst := strings.Cut(spec, ":")
+	if strings.Contains(dst, ":") {
+		return fmt.Errorf("refspec has more than one ':'")
+	}
+	if !hasDst {
+		dst = src
+	}
+	if src == "" && dst == "" {
+		return fmt.Errorf("refspec has neither a source nor a destination")
+	}
+	if hasDst && dst == "" {
+		return fmt.Errorf("destination after ':' is empty")
+	}
+
+	// The source may be any revision (HEAD~1), the destination must be a ref name
+	if strings.ContainsAny(dst, "~^?[\\") || strings.Contains(dst, "..") || strings.HasSuffix(dst, "/") || strings.HasSuffix(dst, ".lock") {
+		return fmt.Errorf("'%s' is not a valid ref name", dst)
+	}
+	if strings.Count(dst, "*") > 1 || (src != "" && strings.Count(src, "*") != strings.Count(dst, "*")) {
+		return fmt.Errorf("wildcards must appear once on both sides")
+	}
+	return nil
+}
+
+func (r Remote) resolveURL(rootDir string) (string, error) {
+	if r.Name == "" || (r.URL == "" && r.URLTemplate == "" && r.Host == "") {
+		return "", fmt.Errorf("remote entries in the config need a name and a url, url_template or host")
+	}
+	if r.Port != 0 && (r.Port < 1 || r.Port > 65535) {
+		return "", fmt.Errorf("remote %s: port %d is out of range (1-65535)", r.Name, r.Port)
+	}
+	if r.URL == "" && r.URLTemplate == "" {
+		url, err := r.hostURL(rootDir)
+		if err != nil {
+			return "", err
+		}
+		r.URL = url
+	}
+
+	// The directory name ends up in the URL the same way it does for host
+	if strings.Contains(r.URL+r.URLTemplate, "{dirname}") {
+		if _, err := resolveRepoName("{dirname}", rootDir); err != nil {
+			return "", fmt.Errorf("remote %s: %v", r.Name, err)
+		}
+	}
+	dirName := filepath.Base(rootDir)
+	values := map[string]string{"dirname": dirName, "name": r.Name, "port": strconv.Itoa(r.Port)}
+	if r.URLTemplate != "" {
+		if r.Port == 0 && strings.Contains(r.URLTemplate, "{port}") {
+			return "", fmt.Errorf("remote %s: url_template uses {port} but no port is set", r.Name)
+		}
+		return expandTemplate(r.URLTemplate, values), nil
+	}
+
+	url := expandTemplate(r.URL, values)
+	if r.Port == 0 {
+		return url, nil
+	}
+
+	// git@host:user/repo.git has no room for a port, switch to ssh://
+	parsed, err := ParseRemoteURL(url)
+	if err != nil {
+		return "", fmt.Errorf("remote %s: %v", r.Name, err)
+	}
+	if parsed.Scheme == "file" {
+		return "", fmt.Errorf("remote %s: a port can't be used with a local path", r.Name)
+	}
+	parsed.SCP = false
+	parsed.Port = strconv.Itoa(r.Port)
+	return parsed.String(), nil
+}
+
+func (r Remote) hostURL(rootDir string) (string, error) {
+	if r.Username == "" {
+		return "", fmt.Errorf("remote %s: host needs a username", r.Name)
+	}
+	repo := r.Repo
+	if repo == "" {
+		repo = "{dirname}"
+	}
+	repo, err := resolveRepoName(repo, rootDir)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ValidateProtocol(r.Protocol); err != nil {
+		return "", fmt.Errorf("remote %s: %v", r.Name, err)
+	}
+	path := r.Username + "/" + repo
+	if prefix := strings.Trim(r.PathPrefix, "/"); prefix != "" {
+		path = prefix + "/" + path
+	}
+	return buildRemoteURL(r.Host, path, r.Protocol), nil
+}
+
+func ValidateProtocol(protocol string) error {
+	switch protocol {
+	case "", "ssh", "https", "git":
+		return nil
+	}
+	return fmt.Errorf("unknown protocol '%s', expected ssh, https or git", protocol)
+}
+
+// HTTPS suits machines that only have a credential helper set up, no SSH key
+func buildRemoteURL(host, path, protocol string) string {
+	switch protocol {
+	case "https":
+		return fmt.Sprintf("https://%s/%s.git", host, path)
+	case "git":
+		return fmt.Sprintf("git://%s/%s.git", host, path)
+	}
+	return fmt.Sprintf("git@%s:%s.git", host, path)
+}
+
+func filterRemotes(remotes []Remote, names []string) ([]Remote, error) {
+	byName := map[string]Remote{}
+	for _, remote := range remotes {
+		byName[remote.Name] = remote
+	}
+
+	filtered := []Remote{}
+	for _, name := range names {
+		remote, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("remote '%s' is not configured", name)
+		}
+		filtered = append(filtered, remote)
+	}
+	return filtered, nil
+}
+
+// git daemon only serves fetches unless started with --enable=receive-pack
+func isGitDaemonURL(url string) bool {
+	parsed, err := ParseRemoteURL(url)
+	return err == nil && parsed.Scheme == "git"
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, path[2:])
+}
+
+func localRemotePath(url string) (string, bool) {
+	if strings.HasPrefix(url, "file://") {
+		return strings.TrimPrefix(url, "file://"), true
+	}
+	if strings.HasPrefix(url, "~/") {
+		return expandHome(url), true
+	}
+	if filepath.IsAbs(url) || strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../") || windowsDrivePath.MatchString(url) {
+		return url, true
+	}
+	return "", false
+}
+
+func (g *GitOperation) ensureBareRepo(path string, createMissing bool) (bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if !createMissing {
+			return false, fmt.Errorf("backup repository %s does not exist, run with --create-missing to create it", path)
+		}
+
+		if g.skipForDryRun("init", "--bare", path) {
+			return false, nil
+		}
+		g.logger.Printf("Creating bare repository at %s", path)
+		if output, err := g.run("init", "--bare", path); err != nil {
+			return false, fmt.Errorf("failed to create bare repository %s: %s", path, string(output))
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to access %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		return false, fmt.Errorf("%s is not a directory", path)
+	}
+
+	output, err := g.output("--git-dir", path, "rev-parse", "--is-bare-repository")
+	if err != nil || strings.TrimSpace(string(output)) != "true" {
+		return false, fmt.Errorf("%s is not a bare git repository", path)
+	}
+	return false, nil
+}
+
+// Removes the git remotes that aren't named in keep, e.g. ones left behind
+// after dropping a remote from the config
+func (g *GitOperation) PruneRemotes(keep []string) error {
+	output, err := g.run("remote")
+	if err != nil {
+		return fmt.Errorf("failed to list remotes: %s", string(output))
+	}
+
+	kept := map[string]bool{}
+	for _, name := range keep {
+		kept[name] = true
+	}
+	for _, name := range strings.Fields(string(output)) {
+		if kept[name] || g.skipForDryRun("remote", "remove", name) {
+			continue
+		}
+		if output, err := g.run("remote", "remove", name); err != nil {
+			return fmt.Errorf("failed to remove remote %s: %s", name, string(output))
+		}
+		g.logger.Printf("Removed remote %s, it is no longer configured", name)
+	}
+	return nil
+}
+
+type RemoteListing struct {
+	Name string
+	// As built from the config
+	URL string
+	// What the git remote of that name points at, empty if there is none
+	GitURL string
+}
+
+// The configured remotes next to the git remotes of the same name, without
+// changing either
+func (g *GitOperation) ListRemotes() ([]RemoteListing, error) {
+	remotes, err := g.Remotes()
+	if err != nil {
+		return nil, err
+	}
+
+	listings := []RemoteListing{}
+	for _, remote := range remotes {
+		listing := RemoteListing{Name: remote.Name, URL: remote.URL}
+		if output, err := g.run("remote", "get-url", remote.Name); err == nil {
+			listing.GitURL = strings.TrimSpace(string(output))
+		}
+		listings = append(listings, listing)
+	}
+	return listings, nil
+}
@@ -0,0 +1,89 @@
+﻿package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateRefspec(t *testing.T) {
+	tests := []struct {
+		refspec string
+		wantErr string
+	}{
+		{"main", ""},
+		{"HEAD:refs/heads/deploy", ""},
+		{"+refs/heads/*:refs/heads/*", ""},
+		{"HEAD~1:refs/heads/previous", ""},
+		{":refs/heads/old", ""},
+		{"refs/tags/v*:refs/tags/v*", ""},
+		{"", "empty"},
+		{"+", "empty"},
+		{"main :main", "whitespace"},
+		{"a:b:c", "more than one ':'"},
+		{":", "neither a source nor a destination"},
+		{"main:", "destination after ':' is empty"},
+		{"main:refs/heads/a..b", "not a valid ref name"},
+		{"main:refs/heads/x~1", "not a valid ref name"},
+		{"main:refs/heads/", "not a valid ref name"},
+		{"main:refs/heads/x.lock", "not a valid ref name"},
+		{"refs/heads/*:refs/heads/main", "wildcards"},
+		{"refs/heads/*:refs/*/*", "wildcards"},
+	}
+
+	for _, tt := range tests {
+		err := validateRefspec(tt.refspec)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("validateRefspec(%q) = %v, want nil", tt.refspec, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("validateRefspec(%q) = %v, want an error containing %q", tt.refspec, err, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	rootDir := filepath.Join(t.TempDir(), "project")
+	tests := []struct {
+		name    string
+		remote  Remote
+		want    string
+		wantErr string
+	}{
+		{"plain url", Remote{Name: "github", URL: "git@github.com:user/repo.git"}, "git@github.com:user/repo.git", ""},
+		{"dirname in url", Remote{Name: "github", URL: "git@github.com:user/{dirname}.git"}, "git@github.com:user/project.git", ""},
+		{"url template", Remote{Name: "backup", URLTemplate: "ssh://git@backup.example.com/{name}/{dirname}.git"}, "ssh://git@backup.example.com/backup/project.git", ""},
+		{"template port", Remote{Name: "backup", URLTemplate: "ssh://git@backup.example.com:{port}/{dirname}.git", Port: 2222}, "ssh://git@backup.example.com:2222/project.git", ""},
+		{"port turns scp into ssh", Remote{Name: "gitea", URL: "git@gitea.example.com:user/repo.git", Port: 2222}, "ssh://git@gitea.example.com:2222/user/repo.git", ""},
+		{"no name", Remote{URL: "git@github.com:user/repo.git"}, "", "need a name"},
+		{"no url", Remote{Name: "github"}, "", "need a name"},
+		{"port out of range", Remote{Name: "github", URL: "git@github.com:user/repo.git", Port: 70000}, "", "out of range"},
+		{"template port unset", Remote{Name: "backup", URLTemplate: "ssh://host:{port}/repo.git"}, "", "no port is set"},
+		{"port on a local path", Remote{Name: "local", URL: "/srv/git/repo.git", Port: 22}, "", "local path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.remote.resolveURL(rootDir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("resolveURL() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveURL() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveURLInvalidDirname(t *testing.T) {
+	remote := Remote{Name: "github", URL: "git@github.com:user/{dirname}.git"}
+	if url, err := remote.resolveURL(filepath.Join(t.TempDir(), "my project")); err == nil {
+		t.Errorf("resolveURL() = %q, want an error for a directory name with a space", url)
+	}
+}
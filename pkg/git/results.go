@@ -0,0 +1,117 @@
+﻿package git
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	FailureUnreachable = "unreachable"
+	FailureAuth        = "auth"
+	FailureNotFound    = "not-found"
+	FailureProtected   = "protected"
+	FailureRejected    = "rejected"
+	FailureError       = "error"
+)
+
+type MirrorResult struct {
+	RemoteName string
+	URL        string
+	// Only set when several branches were pushed
+	Branch  string
+	Success bool
+	Skipped bool
+	Err     error
+	Failure string
+	// Per-ref outcomes reported by the push
+	Refs       []RefOutcome
+	Duration   time.Duration
+	FinishedAt time.Time
+}
+
+var failurePatterns = []struct {
+	failure  string
+	patterns []string
+}{
+	// Auth is checked first since ssh prints "Could not read from remote
+	// repository" for both auth and connection problems
+	{FailureAuth, []string{
+		"permission denied (publickey",
+		"authentication failed",
+		"could not read username",
+		"could not read password",
+		"http basic: access denied",
+		"the requested url returned error: 401",
+		"the requested url returned error: 403",
+		"host key verification failed",
+	}},
+	{FailureProtected, []string{
+		"protected branch",
+	}},
+	{FailureNotFound, []string{
+		"repository not found",
+		"the project you were looking for could not be found",
+		"does not appear to be a git repository",
+		"the requested url returned error: 404",
+	}},
+	{FailureRejected, []string{
+		"[rejected]",
+		"[remote rejected]",
+		"non-fast-forward",
+		"fetch first",
+	}},
+	{FailureUnreachable, []string{
+		"could not resolve hostname",
+		"could not resolve host",
+		"connection timed out",
+		"connection refused",
+		"connection reset",
+		"network is unreachable",
+		"no route to host",
+		"operation timed out",
+		"timed out after",
+		"the remote end hung up unexpectedly",
+		"could not read from remote repository",
+		"unable to access",
+	}},
+}
+
+func classifyFailure(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, group := range failurePatterns {
+		for _, pattern := range group.patterns {
+			if strings.Contains(message, pattern) {
+				return group.failure
+			}
+		}
+	}
+	return FailureError
+}
+
+// The remote's name, followed by the branch when several were pushed
+func (r MirrorResult) Label() string {
+	if r.Branch == "" {
+		return r.RemoteName
+	}
+	return r.RemoteName + "@" + r.Branch
+}
+
+func CompactSummary(results []MirrorResult) string {
+	tokens := []string{}
+	for _, result := range results {
+		status := "ok"
+		switch {
+		case result.Skipped:
+			status = "skipped"
+		case !result.Success:
+			status = fmt.Sprintf("failed(%s)", result.Failure)
+		}
+		tokens = append(tokens, result.Label()+":"+status)
+	}
+	return strings.Join(tokens, " ")
+}
@@ -0,0 +1,48 @@
+﻿package git
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"ssh: Could not resolve hostname github.com: Name or service not known", FailureUnreachable},
+		{"fatal: unable to access 'https://gitlab.com/x.git/': Connection timed out", FailureUnreachable},
+		{"git@github.com: Permission denied (publickey).", FailureAuth},
+		{"remote: HTTP Basic: Access denied", FailureAuth},
+		{"The requested URL returned error: 403", FailureAuth},
+		{"remote: GitLab: You are not allowed to push code to protected branches on this project.\n ! [remote rejected] main -> main (pre-receive hook declined)", FailureProtected},
+		{"remote: error: GH006: Protected branch update failed", FailureProtected},
+		{"ERROR: Repository not found.", FailureNotFound},
+		{"fatal: '/tmp/x.git' does not appear to be a git repository", FailureNotFound},
+		{" ! [remote rejected] main -> main (pre-receive hook declined)", FailureRejected},
+		{" ! [rejected]        main -> main (fetch first)", FailureRejected},
+		{" ! [rejected]        main -> main (non-fast-forward)", FailureRejected},
+		{"something else went wrong", FailureError},
+	}
+
+	for _, tt := range tests {
+		if got := classifyFailure(errors.New(tt.message)); got != tt.want {
+			t.Errorf("classifyFailure(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+	if got := classifyFailure(nil); got != "" {
+		t.Errorf("classifyFailure(nil) = %q, want \"\"", got)
+	}
+}
+
+func TestCompactSummary(t *testing.T) {
+	results := []MirrorResult{
+		{RemoteName: "github", Success: true},
+		{RemoteName: "gitlab", Branch: "dev", Failure: FailureAuth},
+		{RemoteName: "backup", Success: true, Skipped: true},
+	}
+	want := "github:ok gitlab@dev:failed(auth) backup:skipped"
+	if got := CompactSummary(results); got != want {
+		t.Errorf("CompactSummary() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+﻿package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var ErrTimeout = errors.New("timed out")
+
+// Runs git with the given arguments and returns what it wrote to stdout and
+// stderr. Every git command goes through it, so tests can swap in a fake
+// that records the commands and answers the queries
+type Runner interface {
+	Run(args ...string) (stdout, stderr []byte, err error)
+}
+
+// The default runner, executes git in the operation's directory and
+// environment
+type execRunner struct {
+	g *GitOperation
+}
+
+func (r execRunner) Run(args ...string) ([]byte, []byte, error) {
+	return collect(r.g.command(args...))
+}
+
+// Runners that can add environment variables to a single command, such as
+// the SSH key of the remote it talks to. Commands talking to a remote go
+// through RunEnv, the default runner stops them after Options.Timeout
+type EnvRunner interface {
+	Runner
+	RunEnv(env []string, args ...string) (stdout, stderr []byte, err error)
+}
+
+func (r execRunner) RunEnv(env []string, args ...string) ([]byte, []byte, error) {
+	ctx, cancel := r.g.remoteContext()
+	defer cancel()
+	stdout, stderr, err := collect(r.g.remoteCommand(ctx, env, args...))
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return stdout, stderr, fmt.Errorf("%w after %s", ErrTimeout, r.g.options.Timeout)
+	}
+	return stdout, stderr, err
+}
+
+// Runners that can hand the terminal to git, for commands that open an
+// editor or print straight to the user. Other runners get these commands
+// through Run
+type TerminalRunner interface {
+	Runner
+	RunTerminal(env []string, args ...string) error
+}
+
+func (r execRunner) RunTerminal(env []string, args ...string) error {
+	cmd := r.g.command(args...)
+	addEnv(cmd, env)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	if r.g.options.Terminal != nil {
+		cmd.Stdout = r.g.options.Terminal
+	}
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func collect(cmd *exec.Cmd) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+func (g *GitOperation) SetRunner(runner Runner) {
+	g.runner = runner
+}
+
+// Runs git and returns stdout followed by stderr, which is what most
+// callers report
+func (g *GitOperation) run(args ...string) ([]byte, error) {
+	stdout, stderr, err := g.runner.Run(args...)
+	return append(stdout, stderr...), err
+}
+
+// Runs git and returns only its stdout, for queries whose answer is parsed
+func (g *GitOperation) output(args ...string) ([]byte, error) {
+	stdout, _, err := g.runner.Run(args...)
+	return stdout, err
+}
+
+func (g *GitOperation) runTerminal(env []string, args ...string) error {
+	if runner, ok := g.runner.(TerminalRunner); ok {
+		return runner.RunTerminal(env, args...)
+	}
+	_, _, err := g.runner.Run(args...)
+	return err
+}
+
+// Like run, for commands that talk to the given remote. A timeout is
+// added to the output, which is what most callers report
+func (g *GitOperation) runRemote(remote string, args ...string) ([]byte, error) {
+	stdout, stderr, err := g.runRemoteOutput(remote, args...)
+	return append(stdout, stderr...), err
+}
+
+// Like runRemote, with stdout and stderr kept apart. A timeout is added to
+// stderr
+func (g *GitOperation) runRemoteOutput(remote string, args ...string) ([]byte, []byte, error) {
+	runner, ok := g.runner.(EnvRunner)
+	if !ok {
+		return g.runner.Run(args...)
+	}
+	stdout, stderr, err := runner.RunEnv(g.remoteEnv(remote), args...)
+	if g.options.Debug {
+		for _, output := range [][]byte{stdout, stderr} {
+			if len(bytes.TrimSpace(output)) > 0 {
+				g.logger.Printf("[debug] %s", bytes.TrimSpace(output))
+			}
+		}
+	}
+	if errors.Is(err, ErrTimeout) {
+		if len(stderr) > 0 && stderr[len(stderr)-1] != '\n' {
+			stderr = append(stderr, '\n')
+		}
+		stderr = append(stderr, fmt.Sprintf("git %s %v\n", strings.Join(args, " "), err)...)
+	}
+	return stdout, stderr, err
+}
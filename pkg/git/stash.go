@@ -0,0 +1,56 @@
+﻿package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+const autostashMessage = "git-multi-push autostash"
+
+// Stashes the uncommitted changes, untracked files included, and reports
+// whether there were any
+func (g *GitOperation) Stash() (bool, error) {
+	args := []string{"stash", "push", "--include-untracked", "-m", autostashMessage}
+	if g.skipForDryRun(args...) {
+		return false, nil
+	}
+	// git's "No local changes to save" is translated, a new stash entry
+	// isn't
+	before := g.stashTop()
+	output, err := g.run(args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to stash your changes: %s", string(output))
+	}
+	return g.stashTop() != before, nil
+}
+
+// The newest stash entry, empty if there is none
+func (g *GitOperation) stashTop() string {
+	output, err := g.output("rev-parse", "-q", "--verify", "refs/stash")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// Puts the stashed changes back. If they conflict with what was pulled, git
+// keeps them in the stash as well
+func (g *GitOperation) StashPop() error {
+	if g.skipForDryRun("stash", "pop") {
+		return nil
+	}
+	output, err := g.run("stash", "pop")
+	if err == nil {
+		return nil
+	}
+
+	files, _ := g.ConflictedFiles()
+	if len(files) == 0 {
+		return fmt.Errorf("failed to restore your stashed changes, they are still in the stash (git stash list): %s", string(output))
+	}
+	return fmt.Errorf(`%w: your stashed changes conflict with the pulled commits in:
+  %s
+
+Resolve them and 'git add' the files. The changes are still in the stash
+too, drop them with 'git stash drop' once you're done`, ErrConflictsPending, strings.Join(files, "\n  "))
+}
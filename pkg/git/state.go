@@ -0,0 +1,189 @@
+﻿package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	ArtifactRemote   = "remote"
+	ArtifactBareRepo = "bare-repo"
+)
+
+// Something a run created that is left behind if its push fails
+type Artifact struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// The remote the artifact was created for
+	Remote string `json:"remote"`
+}
+
+type RunState struct {
+	Branch        string     `json:"branch,omitempty"`
+	FailedRemotes []string   `json:"failed_remotes,omitempty"`
+	Artifacts     []Artifact `json:"artifacts,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (g *GitOperation) GitDir() (string, error) {
+	output, err := g.output("rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate .git directory: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (g *GitOperation) runStatePath() (string, error) {
+	gitDir, err := g.GitDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, "git-multi-push-state.json"), nil
+}
+
+func (g *GitOperation) LoadRunState() (*RunState, error) {
+	path, err := g.runStatePath()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &RunState{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run state: %v", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid run state in %s: %v", path, err)
+	}
+	return state, nil
+}
+
+func (g *GitOperation) SaveRunState(state *RunState) error {
+	path, err := g.runStatePath()
+	if err != nil {
+		return err
+	}
+
+	state.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run state: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write run state: %v", err)
+	}
+	return nil
+}
+
+func (g *GitOperation) recordPushState(remotes []Remote, results []MirrorResult, created []Artifact) {
+	// Nothing was pushed, keep the state of the last real run
+	if g.options.DryRun {
+		return
+	}
+
+	// With several branches a remote only succeeded if all of them did
+	succeeded := map[string]bool{}
+	for _, result := range results {
+		previous, seen := succeeded[result.RemoteName]
+		succeeded[result.RemoteName] = result.Success && (previous || !seen)
+	}
+
+	// Remotes that were never attempted count as failed too
+	failed := []string{}
+	for _, remote := range remotes {
+		if !succeeded[remote.Name] {
+			failed = append(failed, remote.Name)
+		}
+	}
+
+	state, err := g.LoadRunState()
+	if err != nil {
+		g.warnf("%v", err)
+		state = &RunState{}
+	}
+	state.Branch, _ = g.GetCurrentBranch()
+	state.FailedRemotes = failed
+
+	// A remote that was pushed to is in use, whatever was created for it stays
+	artifacts := []Artifact{}
+	for _, artifact := range append(state.Artifacts, created...) {
+		if !succeeded[artifact.Remote] {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	state.Artifacts = artifacts
+	if err := g.SaveRunState(state); err != nil {
+		g.warnf("%v", err)
+	}
+}
+
+func (g *GitOperation) Cleanup() ([]Artifact, error) {
+	state, err := g.LoadRunState()
+	if err != nil {
+		return nil, err
+	}
+
+	removed, remaining := []Artifact{}, []Artifact{}
+	for _, artifact := range state.Artifacts {
+		if err := g.removeArtifact(artifact); err != nil {
+			g.warnf("%v", err)
+			remaining = append(remaining, artifact)
+			continue
+		}
+		removed = append(removed, artifact)
+	}
+
+	// Nothing was removed, a real --cleanup still needs the records
+	if g.options.DryRun {
+		return removed, nil
+	}
+	state.Artifacts = remaining
+	if err := g.SaveRunState(state); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+func (g *GitOperation) removeArtifact(artifact Artifact) error {
+	switch artifact.Kind {
+	case ArtifactRemote:
+		if !g.remoteExists(artifact.Name) {
+			return nil
+		}
+		if g.skipForDryRun("remote", "remove", artifact.Name) {
+			return nil
+		}
+		if output, err := g.run("remote", "remove", artifact.Name); err != nil {
+			return fmt.Errorf("failed to remove remote %s: %s", artifact.Name, string(output))
+		}
+	case ArtifactBareRepo:
+		if _, err := os.Stat(artifact.Name); os.IsNotExist(err) {
+			return nil
+		}
+		// Only remove the repository while nothing has been pushed to it
+		output, err := g.output("--git-dir", artifact.Name, "for-each-ref", "--count=1")
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s: %v", artifact.Name, err)
+		}
+		if strings.TrimSpace(string(output)) != "" {
+			return fmt.Errorf("%s is not empty, remove it by hand if it is no longer needed", artifact.Name)
+		}
+		if g.options.DryRun {
+			g.logger.Printf("[dry-run] remove %s", artifact.Name)
+			return nil
+		}
+		if err := os.RemoveAll(artifact.Name); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", artifact.Name, err)
+		}
+	default:
+		return fmt.Errorf("unknown artifact kind '%s' in the run state", artifact.Kind)
+	}
+	return nil
+}
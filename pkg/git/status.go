@@ -0,0 +1,73 @@
+﻿package git
+
+import (
+	"fmt"
+	"time"
+)
+
+type MirrorStatus struct {
+	RemoteName string
+	Branch     string
+	Ahead      int
+	Behind     int
+	// The branch hasn't been pushed to the remote yet
+	Missing bool
+	// "ok" or "failed" for the last recorded push, empty if there is none
+	LastPush   string
+	LastPushAt time.Time
+	Err        error
+}
+
+// Fetches every remote, or the named ones, and compares it with the current
+// branch
+func (g *GitOperation) MirrorStatus(only ...string) ([]MirrorStatus, error) {
+	remotes, err := g.Remotes()
+	if err != nil {
+		return nil, err
+	}
+	if len(only) > 0 {
+		if remotes, err = filterRemotes(remotes, only); err != nil {
+			return nil, err
+		}
+	}
+	branch, err := g.GetCurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	if branch == "" {
+		return nil, fmt.Errorf("HEAD is detached, check out a branch to see its mirror status")
+	}
+
+	state, err := g.LoadRunState()
+	if err != nil {
+		return nil, err
+	}
+	failed := map[string]bool{}
+	for _, name := range state.FailedRemotes {
+		failed[name] = true
+	}
+
+	statuses := []MirrorStatus{}
+	for _, remote := range remotes {
+		status := MirrorStatus{RemoteName: remote.Name, Branch: branch}
+		if !state.UpdatedAt.IsZero() && state.Branch == branch {
+			status.LastPush = "ok"
+			if failed[remote.Name] {
+				status.LastPush = "failed"
+			}
+			status.LastPushAt = state.UpdatedAt
+		}
+
+		if !g.remoteExists(remote.Name) {
+			status.Err = fmt.Errorf("not added to this repository yet, push once first")
+		} else if status.Err = g.FetchRemote(remote.Name); status.Err == nil {
+			if !g.RemoteBranchExists(remote.Name, branch) {
+				status.Missing = true
+			} else {
+				status.Ahead, status.Behind, status.Err = g.CheckDivergence(remote.Name, branch)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,44 @@
+﻿package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+type SubmoduleStatus struct {
+	Path    string
+	SHA     string
+	Problem string
+}
+
+func (g *GitOperation) SubmoduleProblems() ([]SubmoduleStatus, error) {
+	output, err := g.run("submodule", "status", "--recursive")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check submodules: %s", string(output))
+	}
+
+	problems := []SubmoduleStatus{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		fields := strings.Fields(line[1:])
+		if len(fields) < 2 {
+			continue
+		}
+
+		status := SubmoduleStatus{SHA: fields[0], Path: fields[1]}
+		switch line[0] {
+		case '-':
+			status.Problem = "not initialized"
+		case '+':
+			status.Problem = "checked out commit differs from the one recorded"
+		case 'U':
+			status.Problem = "has merge conflicts"
+		default:
+			continue
+		}
+		problems = append(problems, status)
+	}
+	return problems, nil
+}
@@ -0,0 +1,159 @@
+﻿package git
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// {branch} keeps the tags of several branches pushed in the same second apart
+const defaultMirrorTagTemplate = "mirrored/{remote}/{branch}/{timestamp}"
+
+var templatePlaceholder = regexp.MustCompile(`\{[a-z]+\}`)
+
+func (g *GitOperation) mirrorTagTemplate() string {
+	if g.config != nil && g.config.MirrorTagTemplate != "" {
+		return g.config.MirrorTagTemplate
+	}
+	return defaultMirrorTagTemplate
+}
+
+func (g *GitOperation) ListTags(pattern string) ([]string, error) {
+	args := []string{"tag", "--list"}
+	if pattern != "" {
+		args = append(args, pattern)
+	}
+
+	output, err := g.output(args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %v", err)
+	}
+
+	tags := []string{}
+	for _, tag := range strings.Split(string(output), "\n") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (g *GitOperation) tagMirrorPush(remote, branch string, pushTag bool) error {
+	// A detached HEAD pushed through a refspec has no branch
+	target, name := "refs/heads/"+branch, branch
+	if branch == "" {
+		target, name = "HEAD", "HEAD"
+	}
+	tag := expandTemplate(g.mirrorTagTemplate(), map[string]string{
+		"remote":    remote,
+		"branch":    name,
+		"timestamp": time.Now().UTC().Format("20060102T150405Z"),
+	})
+
+	if g.options.DryRun {
+		g.skipForDryRun("tag", tag, target)
+		if pushTag {
+			g.skipForDryRun("push", remote, "refs/tags/"+tag)
+		}
+		return nil
+	}
+
+	if output, err := g.run("tag", tag, target); err != nil {
+		return fmt.Errorf("failed to create tag %s: %s", tag, string(output))
+	}
+	g.logger.Printf("Created tag %s", tag)
+
+	if pushTag {
+		if output, err := g.runRemote(remote, "push", remote, "refs/tags/"+tag); err != nil {
+			return fmt.Errorf("failed to push tag %s to %s: %s", tag, remote, string(output))
+		}
+		g.logger.Printf("Pushed tag %s to %s", tag, remote)
+	}
+	return nil
+}
+
+func (g *GitOperation) PruneMirrorTags() ([]string, error) {
+	if g.config == nil {
+		// Without a config the default template still applies
+		if err := g.LoadConfig(); err != nil {
+			g.config = nil
+		}
+	}
+
+	pattern := templatePlaceholder.ReplaceAllString(g.mirrorTagTemplate(), "*")
+	tags, err := g.ListTags(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return tags, nil
+	}
+
+	args := append([]string{"tag", "-d"}, tags...)
+	if g.skipForDryRun(args...) {
+		return tags, nil
+	}
+	if output, err := g.run(args...); err != nil {
+		return nil, fmt.Errorf("failed to delete tags: %s", string(output))
+	}
+	return tags, nil
+}
+
+func (g *GitOperation) VerifyTags(tags []string) ([]string, []string) {
+	passed, failed := []string{}, []string{}
+	for _, tag := range tags {
+		if output, err := g.run("tag", "-v", tag); err != nil {
+			g.logger.Printf("Tag %s failed verification: %s", tag, strings.TrimSpace(string(output)))
+			failed = append(failed, tag)
+			continue
+		}
+		passed = append(passed, tag)
+	}
+	return passed, failed
+}
+
+func (g *GitOperation) tagsToPush(opts PushOptions) ([]string, error) {
+	pattern := opts.TagPattern
+	if opts.Tag != "" {
+		pattern = opts.Tag
+	}
+	tags, err := g.ListTags(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Tag != "" && (len(tags) != 1 || tags[0] != opts.Tag) {
+		return nil, fmt.Errorf("tag '%s' does not exist locally (see git tag --list)", opts.Tag)
+	}
+	if !opts.VerifyTags {
+		return tags, nil
+	}
+
+	passed, failed := g.VerifyTags(tags)
+	if len(passed) > 0 {
+		g.logger.Printf("Tags with a valid signature: %s", strings.Join(passed, ", "))
+	}
+	if len(failed) > 0 {
+		g.warnf("Refusing to push tags that failed verification: %s", strings.Join(failed, ", "))
+	}
+	return passed, nil
+}
+
+func (g *GitOperation) pushTags(remote string, tags []string, forcePush bool) error {
+	args := []string{"push", remote}
+	if forcePush {
+		args = append(args, "--force")
+	}
+	for _, tag := range tags {
+		args = append(args, "refs/tags/"+tag)
+	}
+	if g.skipForDryRun(args...) {
+		return nil
+	}
+
+	if output, err := g.runRemote(remote, args...); err != nil {
+		return fmt.Errorf("failed to push tags to %s: %s", remote, string(output))
+	}
+	g.logger.Printf("Pushed %d tag(s) to %s", len(tags), remote)
+	return nil
+}
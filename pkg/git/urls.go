@@ -0,0 +1,166 @@
+﻿package git
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	ProviderGithub    = "github"
+	ProviderGitlab    = "gitlab"
+	ProviderBitbucket = "bitbucket"
+	ProviderLocal     = "local"
+	ProviderGeneric   = "generic"
+)
+
+type RemoteURL struct {
+	Scheme string
+	User   string
+	Host   string
+	Port   string
+	Path   string
+	// scp-like syntax such as git@github.com:user/repo.git
+	SCP bool
+}
+
+var scpURL = regexp.MustCompile(`^(?:([^@/]+)@)?([^:/]+):(.+)$`)
+
+func ParseRemoteURL(raw string) (*RemoteURL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("remote url is empty")
+	}
+	if strings.ContainsAny(raw, " \t\n") {
+		return nil, fmt.Errorf("remote url '%s' contains whitespace", raw)
+	}
+
+	if path, ok := localRemotePath(raw); ok {
+		// Keep relative paths relative, "./backup" must not turn into "backup"
+		return &RemoteURL{Scheme: "file", Path: strings.TrimRight(path, `/\`)}, nil
+	}
+
+	if strings.Contains(raw, "://") {
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote url '%s': %v", raw, err)
+		}
+
+		scheme := strings.ToLower(parsed.Scheme)
+		switch scheme {
+		case "ssh", "git", "http", "https":
+		default:
+			return nil, fmt.Errorf("unsupported scheme '%s' in remote url '%s'", parsed.Scheme, raw)
+		}
+
+		path := strings.Trim(parsed.Path, "/")
+		if parsed.Hostname() == "" || path == "" {
+			return nil, fmt.Errorf("remote url '%s' needs a host and a repository path", raw)
+		}
+		return &RemoteURL{
+			Scheme: scheme,
+			User:   parsed.User.Username(),
+			Host:   strings.ToLower(parsed.Hostname()),
+			Port:   parsed.Port(),
+			Path:   path,
+		}, nil
+	}
+
+	match := scpURL.FindStringSubmatch(raw)
+	if match == nil {
+		return nil, fmt.Errorf("unrecognized remote url '%s'", raw)
+	}
+	path := strings.Trim(match[3], "/")
+	if path == "" {
+		return nil, fmt.Errorf("remote url '%s' needs a repository path", raw)
+	}
+	return &RemoteURL{
+		Scheme: "ssh",
+		User:   match[1],
+		Host:   strings.ToLower(match[2]),
+		Path:   path,
+		SCP:    true,
+	}, nil
+}
+
+func (u *RemoteURL) Provider() string {
+	switch {
+	case u.Scheme == "file":
+		return ProviderLocal
+	case u.Host == "github.com" || strings.HasSuffix(u.Host, ".github.com"):
+		return ProviderGithub
+	case strings.Contains(u.Host, "gitlab"):
+		return ProviderGitlab
+	case u.Host == "bitbucket.org":
+		return ProviderBitbucket
+	}
+	return ProviderGeneric
+}
+
+func (u *RemoteURL) String() string {
+	path := u.Path
+	// The hosted providers accept both forms, keep one so duplicates match
+	if provider := u.Provider(); (provider == ProviderGithub || provider == ProviderGitlab || provider == ProviderBitbucket) && !strings.HasSuffix(path, ".git") {
+		path += ".git"
+	}
+
+	switch {
+	case u.Scheme == "file":
+		return path
+	case u.SCP:
+		if u.User != "" {
+			return fmt.Sprintf("%s@%s:%s", u.User, u.Host, path)
+		}
+		return fmt.Sprintf("%s:%s", u.Host, path)
+	}
+
+	host := u.Host
+	if u.Port != "" {
+		host += ":" + u.Port
+	}
+	if u.User != "" {
+		host = u.User + "@" + host
+	}
+	return fmt.Sprintf("%s://%s/%s", u.Scheme, host, path)
+}
+
+func NormalizeRemoteURL(raw string) (string, error) {
+	parsed, err := ParseRemoteURL(raw)
+	if err != nil {
+		return "", err
+	}
+	return parsed.String(), nil
+}
+
+// The repository name at the end of a remote URL, without ".git"
+func ExtractRepoName(raw string) (string, error) {
+	parsed, err := ParseRemoteURL(raw)
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSuffix(strings.ReplaceAll(parsed.Path, `\`, "/"), ".git")
+	name := path[strings.LastIndex(path, "/")+1:]
+	if name == "" {
+		return "", fmt.Errorf("remote url '%s' has no repository name", raw)
+	}
+	return name, nil
+}
+
+func (g *GitOperation) GitRemotes() ([]Remote, error) {
+	output, err := g.run("remote", "-v")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list git remotes: %s", string(output))
+	}
+
+	remotes := []Remote{}
+	for _, line := range strings.Split(string(output), "\n") {
+		// Every remote shows up twice, once for fetch and once for push
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[2] != "(fetch)" {
+			continue
+		}
+		remotes = append(remotes, Remote{Name: fields[0], URL: fields[1]})
+	}
+	return remotes, nil
+}
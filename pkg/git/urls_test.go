@@ -0,0 +1,86 @@
+﻿package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRemoteURL(t *testing.T) {
+	tests := []struct {
+		raw      string
+		want     RemoteURL
+		provider string
+		str      string
+	}{
+		{
+			"git@github.com:user/repo.git",
+			RemoteURL{Scheme: "ssh", User: "git", Host: "github.com", Path: "user/repo.git", SCP: true},
+			ProviderGithub, "git@github.com:user/repo.git",
+		},
+		{
+			"git@GitHub.com:user/repo",
+			RemoteURL{Scheme: "ssh", User: "git", Host: "github.com", Path: "user/repo", SCP: true},
+			ProviderGithub, "git@github.com:user/repo.git",
+		},
+		{
+			"https://gitlab.example.com/group/sub/repo.git",
+			RemoteURL{Scheme: "https", Host: "gitlab.example.com", Path: "group/sub/repo.git"},
+			ProviderGitlab, "https://gitlab.example.com/group/sub/repo.git",
+		},
+		{
+			"ssh://git@bitbucket.org:2222/team/repo/",
+			RemoteURL{Scheme: "ssh", User: "git", Host: "bitbucket.org", Port: "2222", Path: "team/repo"},
+			ProviderBitbucket, "ssh://git@bitbucket.org:2222/team/repo.git",
+		},
+		{
+			"git://git.example.com/repo.git",
+			RemoteURL{Scheme: "git", Host: "git.example.com", Path: "repo.git"},
+			ProviderGeneric, "git://git.example.com/repo.git",
+		},
+		{
+			"/srv/git/repo.git/",
+			RemoteURL{Scheme: "file", Path: "/srv/git/repo.git"},
+			ProviderLocal, "/srv/git/repo.git",
+		},
+		{
+			"./backup",
+			RemoteURL{Scheme: "file", Path: "./backup"},
+			ProviderLocal, "./backup",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseRemoteURL(tt.raw)
+			if err != nil {
+				t.Fatalf("ParseRemoteURL(%q) failed: %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("ParseRemoteURL(%q) = %+v, want %+v", tt.raw, *got, tt.want)
+			}
+			if provider := got.Provider(); provider != tt.provider {
+				t.Errorf("Provider() = %q, want %q", provider, tt.provider)
+			}
+			if str := got.String(); str != tt.str {
+				t.Errorf("String() = %q, want %q", str, tt.str)
+			}
+		})
+	}
+}
+
+func TestParseRemoteURLErrors(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"   ",
+		"git@github.com:user/my repo.git",
+		"ftp://example.com/repo.git",
+		"https://github.com/",
+		"https:///repo.git",
+		"git@github.com:",
+		"not a url",
+	} {
+		if got, err := ParseRemoteURL(raw); err == nil {
+			t.Errorf("ParseRemoteURL(%q) = %+v, want an error", raw, *got)
+		}
+	}
+}